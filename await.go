@@ -0,0 +1,170 @@
+package dcrharness
+
+import (
+	"context"
+	"fmt"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrjson"
+	"github.com/jfixby/coinharness"
+	"strings"
+	"time"
+)
+
+// awaitPollInterval is the delay between checks of the await helpers
+// when the clients are not registered for the relevant notifications
+const awaitPollInterval = 100 * time.Millisecond
+
+// awaitSafetyInterval is the delay between checks of the await helpers
+// when notifications are on, it covers notifications missed
+// on the way
+const awaitSafetyInterval = 2 * time.Second
+
+// WaitForHeight blocks until the node reaches the given height.
+// An error is returned when the context is done first.
+func WaitForHeight(ctx context.Context, client coinharness.RPCClient, height int64) error {
+	kinds := []EventKind{BlockConnectedEventKind}
+	return awaitCondition(ctx, []coinharness.RPCClient{client}, kinds, func() (bool, error) {
+		count, err := client.GetBlockCount()
+		if err != nil {
+			return false, err
+		}
+		return count >= height, nil
+	}, fmt.Sprintf("height %v", height))
+}
+
+// WaitForTx blocks until the transaction is in the node mempool or in
+// a block. The transaction mined before it is seen in the mempool is found
+// only when the node runs with the transaction index.
+// An error is returned when the context is done first.
+func WaitForTx(ctx context.Context, client coinharness.RPCClient, hash coinharness.Hash) error {
+	txHash := hash.(*chainhash.Hash)
+	c, err := harnessClient(client)
+	if err != nil {
+		return err
+	}
+	kinds := []EventKind{TxAcceptedEventKind, TxAcceptedVerboseEventKind,
+		BlockConnectedEventKind}
+	return awaitCondition(ctx, []coinharness.RPCClient{client}, kinds, func() (bool, error) {
+		mempool, err := client.GetRawMempool(dcrjson.GRMAll)
+		if err != nil {
+			return false, err
+		}
+		for _, e := range mempool {
+			if txHash.IsEqual(e.(*chainhash.Hash)) {
+				return true, nil
+			}
+		}
+		tx, err := c.GetRawTransactionVerbose(txHash)
+		if err != nil && (strings.Contains(err.Error(), noTxInfo) ||
+			strings.Contains(err.Error(), noTxIndex)) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return tx.Confirmations > 0, nil
+	}, fmt.Sprintf("tx %v in mempool or chain", txHash))
+}
+
+// noTxInfo is the error text of dcrd when the transaction is neither
+// in the mempool nor in the chain, yet
+const noTxInfo = "No information available about transaction"
+
+// noTxIndex is the error text of dcrd when the transaction is not in the
+// mempool and the node runs without the transaction index
+const noTxIndex = "The transaction index must be enabled"
+
+// WaitForConfirmations blocks until the transaction gets the given number
+// of confirmations. The node must run with the transaction index. The
+// transaction unknown to the node is waited for. An error is returned when
+// the context is done first.
+func WaitForConfirmations(ctx context.Context, client coinharness.RPCClient, hash coinharness.Hash, confirmations int64) error {
+	txHash := hash.(*chainhash.Hash)
+	c, err := harnessClient(client)
+	if err != nil {
+		return err
+	}
+	kinds := []EventKind{BlockConnectedEventKind}
+	return awaitCondition(ctx, []coinharness.RPCClient{client}, kinds, func() (bool, error) {
+		tx, err := c.GetRawTransactionVerbose(txHash)
+		if err != nil && strings.Contains(err.Error(), noTxInfo) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return tx.Confirmations >= confirmations, nil
+	}, fmt.Sprintf("%v confirmations of tx %v", confirmations, txHash))
+}
+
+// WaitForSameBestBlock blocks until all the nodes report the same best block
+// and returns it. An error is returned when the context is done first.
+func WaitForSameBestBlock(ctx context.Context, clients ...coinharness.RPCClient) (coinharness.Hash, int64, error) {
+	var bestHash *chainhash.Hash
+	var bestHeight int64
+	kinds := []EventKind{BlockConnectedEventKind, BlockDisconnectedEventKind}
+	err := awaitCondition(ctx, clients, kinds, func() (bool, error) {
+		bestHash = nil
+		for _, client := range clients {
+			hash, height, err := client.GetBestBlock()
+			if err != nil {
+				return false, err
+			}
+			h := hash.(*chainhash.Hash)
+			if bestHash != nil && !bestHash.IsEqual(h) {
+				return false, nil
+			}
+			bestHash = h
+			bestHeight = height
+		}
+		return true, nil
+	}, "nodes to agree on the best block")
+	if err != nil {
+		return nil, 0, err
+	}
+	return bestHash, bestHeight, nil
+}
+
+// awaitCondition checks the condition until it holds. The condition is
+// checked again on every event of the given kinds received by the clients
+// and periodically, more often when the clients are not registered for
+// the notifications.
+func awaitCondition(ctx context.Context, clients []coinharness.RPCClient, kinds []EventKind, condition func() (bool, error), what string) error {
+	wake := make(chan struct{}, 1)
+	interval := awaitSafetyInterval
+	for _, client := range clients {
+		c, ok := client.(*RPCClient)
+		if !ok || !c.notifier.isRegistered(kinds) {
+			interval = awaitPollInterval
+			continue
+		}
+		s := c.Subscribe(&SubscribeArgs{Kinds: kinds, BufferSize: 1})
+		defer s.Unsubscribe()
+		go func() {
+			for range s.Events {
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		done, err := condition()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timeout waiting for %v: %v", what, ctx.Err())
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package dcrharness
+
+import (
+	"fmt"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/wire"
+	"github.com/jfixby/coinharness"
+	"time"
+)
+
+// MsgBlockHeader is the harness representation of the decred block header
+type MsgBlockHeader struct {
+	Version      int32
+	PrevBlock    coinharness.Hash
+	MerkleRoot   coinharness.Hash
+	StakeRoot    coinharness.Hash
+	VoteBits     uint16
+	FinalState   [6]byte
+	Voters       uint16
+	FreshStake   uint8
+	Revocations  uint8
+	PoolSize     uint32
+	Bits         uint32
+	SBits        int64
+	Height       int64
+	Size         uint32
+	Timestamp    time.Time
+	Nonce        uint32
+	ExtraData    [32]byte
+	StakeVersion uint32
+}
+
+// MsgBlock is the harness representation of the decred block
+// including the header and the stake tree
+type MsgBlock struct {
+	BlockHash     coinharness.Hash
+	Header        MsgBlockHeader
+	Transactions  []*coinharness.MessageTx
+	STransactions []*coinharness.MessageTx
+}
+
+// HarnessBlock returns the block in the coinharness.MsgBlock form,
+// the header and the stake tree are dropped as the form has no fields
+// for them
+func (b *MsgBlock) HarnessBlock() *coinharness.MsgBlock {
+	return &coinharness.MsgBlock{
+		Transactions: b.Transactions,
+	}
+}
+
+// msgBlockGetter is implemented by the clients able to load the full block
+type msgBlockGetter interface {
+	GetMsgBlock(hash coinharness.Hash) (*MsgBlock, error)
+}
+
+// GetFullBlock returns the block with the given hash including its header
+// and the stake tree. The coinharness.RPCClient GetBlock() result has no
+// room for them, so the client must implement GetMsgBlock() the way
+// RPCClient and ReplayRPCClient do.
+func GetFullBlock(client coinharness.RPCClient, hash coinharness.Hash) (*MsgBlock, error) {
+	c, ok := client.(msgBlockGetter)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support full blocks", client)
+	}
+	return c.GetMsgBlock(hash)
+}
+
+func BlockHeaderRawToHeader(h *wire.BlockHeader) MsgBlockHeader {
+	prevBlock := h.PrevBlock
+	merkleRoot := h.MerkleRoot
+	stakeRoot := h.StakeRoot
+	return MsgBlockHeader{
+		Version:      h.Version,
+		PrevBlock:    &prevBlock,
+		MerkleRoot:   &merkleRoot,
+		StakeRoot:    &stakeRoot,
+		VoteBits:     h.VoteBits,
+		FinalState:   h.FinalState,
+		Voters:       h.Voters,
+		FreshStake:   h.FreshStake,
+		Revocations:  h.Revocations,
+		PoolSize:     h.PoolSize,
+		Bits:         h.Bits,
+		SBits:        h.SBits,
+		Height:       int64(h.Height),
+		Size:         h.Size,
+		Timestamp:    h.Timestamp,
+		Nonce:        h.Nonce,
+		ExtraData:    h.ExtraData,
+		StakeVersion: h.StakeVersion,
+	}
+}
+
+// BlockHeaderToRaw converts the header back into the wire form
+func BlockHeaderToRaw(h *MsgBlockHeader) *wire.BlockHeader {
+	return &wire.BlockHeader{
+		Version:      h.Version,
+		PrevBlock:    *h.PrevBlock.(*chainhash.Hash),
+		MerkleRoot:   *h.MerkleRoot.(*chainhash.Hash),
+		StakeRoot:    *h.StakeRoot.(*chainhash.Hash),
+		VoteBits:     h.VoteBits,
+		FinalState:   h.FinalState,
+		Voters:       h.Voters,
+		FreshStake:   h.FreshStake,
+		Revocations:  h.Revocations,
+		PoolSize:     h.PoolSize,
+		Bits:         h.Bits,
+		SBits:        h.SBits,
+		Height:       uint32(h.Height),
+		Size:         h.Size,
+		Timestamp:    h.Timestamp,
+		Nonce:        h.Nonce,
+		ExtraData:    h.ExtraData,
+		StakeVersion: h.StakeVersion,
+	}
+}
+
+func BlockRawToMsgBlock(block *wire.MsgBlock) *MsgBlock {
+	hash := block.BlockHash()
+	b := &MsgBlock{
+		BlockHash: &hash,
+		Header:    BlockHeaderRawToHeader(&block.Header),
+	}
+	for _, tx := range block.Transactions {
+		b.Transactions = append(b.Transactions, TransactionRawToTx(tx))
+	}
+	for _, tx := range block.STransactions {
+		b.STransactions = append(b.STransactions, TransactionRawToTx(tx))
+	}
+	return b
+}
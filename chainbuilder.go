@@ -0,0 +1,212 @@
+package dcrharness
+
+import (
+	"context"
+	"fmt"
+	"github.com/decred/dcrd/chaincfg"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/wire"
+	"github.com/jfixby/coinharness"
+	"sync"
+)
+
+// ChainBuilder builds branches of blocks off any block known to the node
+// or built earlier by the ChainBuilder itself, and keeps track of the tips
+// of all the branches. It is used to construct side chains and to test
+// reorganizations of the node. ChainBuilder is safe for concurrent access.
+type ChainBuilder struct {
+	Client        coinharness.RPCClient
+	Network       *chaincfg.Params
+	MiningAddress dcrutil.Address
+	// BlockVersion is the version of the built blocks, zero stands for
+	// the version of the node's best block so that the blocks are not
+	// rejected as obsolete
+	BlockVersion int32
+	// StakeProvider returns the stake part of the block built on top
+	// of the given one, blocks have no stake tree when it is nil
+	StakeProvider func(prevBlock *dcrutil.Block) (*BlockStake, error)
+	// Context bounds the proof-of-work search of every built block,
+	// DefaultSolveTimeout applies when it is nil or has no deadline
+	Context context.Context
+
+	mtx    sync.Mutex
+	blocks map[chainhash.Hash]*dcrutil.Block
+	tips   map[chainhash.Hash]*dcrutil.Block
+}
+
+// NewChainBuilder creates a ChainBuilder producing blocks for the node
+// the client is connected to
+func NewChainBuilder(client coinharness.RPCClient, net *chaincfg.Params, miningAddress dcrutil.Address) *ChainBuilder {
+	return &ChainBuilder{
+		Client:        client,
+		Network:       net,
+		MiningAddress: miningAddress,
+		blocks:        make(map[chainhash.Hash]*dcrutil.Block),
+		tips:          make(map[chainhash.Hash]*dcrutil.Block),
+	}
+}
+
+// BuildBranch builds length blocks on top of the block with the given hash
+// and returns them in the chain order. The blocks are not submitted.
+func (b *ChainBuilder) BuildBranch(from *chainhash.Hash, length int) ([]*dcrutil.Block, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	prev, err := b.block(from)
+	if err != nil {
+		return nil, err
+	}
+	version := b.BlockVersion
+	if version == 0 {
+		version, err = b.bestBlockVersion()
+		if err != nil {
+			return nil, err
+		}
+	}
+	branch := []*dcrutil.Block{}
+	for i := 0; i < length; i++ {
+		ancestors, err := b.ancestors(prev.Hash(),
+			AncestorsRequiredAt(prev.Height(), b.Network))
+		if err != nil {
+			return nil, err
+		}
+		var stake *BlockStake
+		if b.StakeProvider != nil {
+			stake, err = b.StakeProvider(prev)
+			if err != nil {
+				return nil, err
+			}
+		}
+		block, err := CreateBlockWithArgs(&CreateBlockArgs{
+			PrevBlock:     prev,
+			BlockVersion:  version,
+			MiningAddress: b.MiningAddress,
+			Network:       b.Network,
+			Ancestors:     ancestors,
+			Stake:         stake,
+			Context:       b.Context,
+		})
+		if err != nil {
+			return nil, err
+		}
+		b.blocks[*block.Hash()] = block
+		delete(b.tips, *prev.Hash())
+		b.tips[*block.Hash()] = block
+		branch = append(branch, block)
+		prev = block
+	}
+	return branch, nil
+}
+
+// Submit submits the blocks to the node in the given order
+func (b *ChainBuilder) Submit(blocks ...*dcrutil.Block) error {
+	for _, block := range blocks {
+		if err := b.Client.SubmitBlock(block); err != nil {
+			return fmt.Errorf("block %v at height %v rejected: %v",
+				block.Hash(), block.Height(), err)
+		}
+	}
+	return nil
+}
+
+// Tips returns the hashes of the tips of all the branches built so far
+func (b *ChainBuilder) Tips() []*chainhash.Hash {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	tips := make([]*chainhash.Hash, 0, len(b.tips))
+	for _, block := range b.tips {
+		tips = append(tips, block.Hash())
+	}
+	return tips
+}
+
+// Block returns a block built by the ChainBuilder
+func (b *ChainBuilder) Block(hash *chainhash.Hash) (*dcrutil.Block, bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	block, ok := b.blocks[*hash]
+	return block, ok
+}
+
+// BestTip reports the best block of the node and whether
+// it is one of the tips built by the ChainBuilder
+func (b *ChainBuilder) BestTip() (*chainhash.Hash, int64, bool, error) {
+	hash, height, err := b.Client.GetBestBlock()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	best := hash.(*chainhash.Hash)
+	b.mtx.Lock()
+	_, isTip := b.tips[*best]
+	b.mtx.Unlock()
+	return best, height, isTip, nil
+}
+
+// AssertBestTip returns an error unless the node's best block
+// is the expected one
+func (b *ChainBuilder) AssertBestTip(expected *chainhash.Hash) error {
+	best, height, _, err := b.BestTip()
+	if err != nil {
+		return err
+	}
+	if *best != *expected {
+		return fmt.Errorf("node is on tip %v at height %v, expected %v",
+			best, height, expected)
+	}
+	return nil
+}
+
+// block returns the block built by the ChainBuilder or loads it from the node
+func (b *ChainBuilder) block(hash *chainhash.Hash) (*dcrutil.Block, error) {
+	if block, ok := b.blocks[*hash]; ok {
+		return block, nil
+	}
+	c, err := harnessClient(b.Client)
+	if err != nil {
+		return nil, err
+	}
+	msgBlock, err := c.rawBlock(hash)
+	if err != nil {
+		return nil, err
+	}
+	return dcrutil.NewBlock(msgBlock), nil
+}
+
+// bestBlockVersion returns the header version of the node's best block
+func (b *ChainBuilder) bestBlockVersion() (int32, error) {
+	c, err := harnessClient(b.Client)
+	if err != nil {
+		return 0, err
+	}
+	hash, _, err := c.GetBestBlock()
+	if err != nil {
+		return 0, err
+	}
+	header, err := c.GetBlockHeader(hash)
+	if err != nil {
+		return 0, err
+	}
+	return BlockHeaderToRaw(header).Version, nil
+}
+
+// ancestors is FetchAncestors that also walks through the blocks
+// built by the ChainBuilder and not yet known to the node
+func (b *ChainBuilder) ancestors(hash *chainhash.Hash, count int64) ([]*wire.BlockHeader, error) {
+	headers := []*wire.BlockHeader{}
+	for int64(len(headers)) < count {
+		block, ok := b.blocks[*hash]
+		if !ok {
+			rest, err := FetchAncestors(b.Client, hash,
+				count-int64(len(headers)))
+			if err != nil {
+				return nil, err
+			}
+			return append(headers, rest...), nil
+		}
+		header := &block.MsgBlock().Header
+		headers = append(headers, header)
+		hash = &header.PrevBlock
+	}
+	return headers, nil
+}
@@ -0,0 +1,359 @@
+package dcrharness
+
+import (
+	"fmt"
+	"github.com/decred/dcrd/blockchain"
+	"github.com/decred/dcrd/chaincfg"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/wire"
+	"github.com/jfixby/coinharness"
+	"math/big"
+	"time"
+)
+
+// AncestorsRequired returns the number of headers, the tip included, the
+// difficulty calculations need to look back at for the given network
+func AncestorsRequired(net *chaincfg.Params) int64 {
+	work := net.WorkDiffWindowSize*net.WorkDiffWindows + 1
+	stake := net.StakeDiffWindowSize + int64(net.TicketMaturity) + 2
+	if stake > work {
+		return stake
+	}
+	return work
+}
+
+// AncestorsRequiredAt returns the number of headers, the tip included, the
+// difficulty calculations of the block following the tip at the given height
+// look back at. Off the retarget heights the tip alone carries both
+// difficulties unless the network reduces the minimum difficulty.
+func AncestorsRequiredAt(tipHeight int64, net *chaincfg.Params) int64 {
+	next := tipHeight + 1
+	if net.ReduceMinDifficulty || next%net.WorkDiffWindowSize == 0 ||
+		next%net.StakeDiffWindowSize == 0 {
+		return AncestorsRequired(net)
+	}
+	return 1
+}
+
+// checkAncestors returns an error unless the headers start with the header
+// of the block with the given hash and are enough for AncestorsRequiredAt()
+func checkAncestors(headers []*wire.BlockHeader, prevHash *chainhash.Hash, net *chaincfg.Params) error {
+	if len(headers) == 0 {
+		return fmt.Errorf("ancestors of block %v are required to compute "+
+			"the difficulty of the next block", prevHash)
+	}
+	tip := headers[0]
+	if tipHash := tip.BlockHash(); tipHash != *prevHash {
+		return fmt.Errorf("ancestors start at block %v, expected %v",
+			tipHash, prevHash)
+	}
+	required := AncestorsRequiredAt(int64(tip.Height), net)
+	oldest := headers[len(headers)-1]
+	if int64(len(headers)) < required && oldest.Height != 0 {
+		return fmt.Errorf("%v ancestors of block %v are required at "+
+			"height %v, got %v", required, prevHash, tip.Height,
+			len(headers))
+	}
+	return nil
+}
+
+// FetchAncestors loads the header of the block with the given hash followed
+// by the headers of its ancestors, newest first. Fewer headers are returned
+// when the genesis block is reached.
+func FetchAncestors(client coinharness.RPCClient, hash *chainhash.Hash, count int64) ([]*wire.BlockHeader, error) {
+	c, err := harnessClient(client)
+	if err != nil {
+		return nil, err
+	}
+	headers := []*wire.BlockHeader{}
+	for int64(len(headers)) < count {
+		h, err := c.GetBlockHeader(hash)
+		if err != nil {
+			return nil, err
+		}
+		header := BlockHeaderToRaw(h)
+		headers = append(headers, header)
+		if header.Height == 0 {
+			break
+		}
+		hash = &header.PrevBlock
+	}
+	return headers, nil
+}
+
+// ancestor returns the header at the given height from the list of headers
+// ordered newest first, nil is returned for heights out of the list
+func ancestor(headers []*wire.BlockHeader, height int64) *wire.BlockHeader {
+	if len(headers) == 0 {
+		return nil
+	}
+	idx := int64(headers[0].Height) - height
+	if idx < 0 || idx >= int64(len(headers)) {
+		return nil
+	}
+	return headers[idx]
+}
+
+// CalcNextRequiredDifficulty calculates the proof-of-work difficulty bits of
+// the block following headers[0] and having the given timestamp. The headers
+// are the tip followed by its ancestors, newest first, as returned by
+// FetchAncestors. This mirrors the retarget rules of dcrd.
+func CalcNextRequiredDifficulty(headers []*wire.BlockHeader, newBlockTime time.Time, net *chaincfg.Params) uint32 {
+	if len(headers) == 0 {
+		return net.PowLimitBits
+	}
+	curNode := headers[0]
+	oldDiff := curNode.Bits
+	oldDiffBig := blockchain.CompactToBig(curNode.Bits)
+
+	// We're not at a retarget point, return the oldDiff.
+	if (int64(curNode.Height)+1)%net.WorkDiffWindowSize != 0 {
+		if !net.ReduceMinDifficulty {
+			return oldDiff
+		}
+
+		// Return minimum difficulty when more than the desired
+		// amount of time has elapsed without mining a block.
+		reductionTime := net.MinDiffReductionTime
+		if newBlockTime.After(curNode.Timestamp.Add(reductionTime)) {
+			return net.PowLimitBits
+		}
+
+		// The block was mined within the desired timeframe, so
+		// return the difficulty for the last block which did
+		// not have the special minimum difficulty rule applied.
+		blocksPerRetarget := net.WorkDiffWindowSize * net.WorkDiffWindows
+		for _, h := range headers {
+			if int64(h.Height)%blocksPerRetarget == 0 ||
+				h.Bits != net.PowLimitBits {
+				return h.Bits
+			}
+		}
+		return net.PowLimitBits
+	}
+
+	// Declare some useful variables.
+	RAFBig := big.NewInt(net.RetargetAdjustmentFactor)
+	nextDiffBigMin := blockchain.CompactToBig(curNode.Bits)
+	nextDiffBigMin.Div(nextDiffBigMin, RAFBig)
+	nextDiffBigMax := blockchain.CompactToBig(curNode.Bits)
+	nextDiffBigMax.Mul(nextDiffBigMax, RAFBig)
+
+	alpha := net.WorkDiffAlpha
+	targetTimespan := int64(net.TargetTimespan / time.Second)
+
+	// Number of nodes to traverse while calculating difficulty.
+	nodesToTraverse := net.WorkDiffWindowSize * net.WorkDiffWindows
+
+	// Regress through all of the previous blocks and store the percent
+	// changes per window period; use bigInts to emulate 64.32 bit fixed
+	// point.
+	windowChanges := make([]*big.Int, net.WorkDiffWindows)
+	var windowPeriod int64
+	var weights uint64
+	oldNode := curNode
+	oldIdx := 0
+	recentTime := curNode.Timestamp.Unix()
+
+	for i := int64(0); ; i++ {
+		// Store and reset after reaching the end of every window period.
+		if i%net.WorkDiffWindowSize == 0 && i != 0 {
+			olderTime := oldNode.Timestamp.Unix()
+			timeDifference := recentTime - olderTime
+
+			// Just assume we're at the target (no change) if we've
+			// gone all the way back to the genesis block.
+			if oldNode.Height == 0 {
+				timeDifference = targetTimespan
+			}
+
+			timeDifBig := big.NewInt(timeDifference)
+			timeDifBig.Lsh(timeDifBig, 32) // Add padding
+			targetTemp := big.NewInt(targetTimespan)
+			windowAdjusted := targetTemp.Div(timeDifBig, targetTemp)
+
+			// Weight it exponentially.
+			windowAdjusted = windowAdjusted.Lsh(windowAdjusted,
+				uint((net.WorkDiffWindows-windowPeriod)*alpha))
+			weights += 1 << uint64((net.WorkDiffWindows-windowPeriod)*alpha)
+			windowChanges[windowPeriod] = windowAdjusted
+
+			windowPeriod++
+			recentTime = olderTime
+		}
+
+		if i == nodesToTraverse {
+			break
+		}
+
+		// Get the previous node while staying at the oldest
+		// known block as needed.
+		if oldIdx+1 < len(headers) {
+			oldIdx++
+			oldNode = headers[oldIdx]
+		}
+	}
+
+	// Sum up the weighted window periods.
+	weightedSum := big.NewInt(0)
+	for i := int64(0); i < net.WorkDiffWindows; i++ {
+		weightedSum.Add(weightedSum, windowChanges[i])
+	}
+
+	// Divide by the sum of all weights.
+	weightsBig := big.NewInt(int64(weights))
+	weightedSumDiv := weightedSum.Div(weightedSum, weightsBig)
+
+	// Multiply by the old diff.
+	nextDiffBig := weightedSumDiv.Mul(weightedSumDiv, oldDiffBig)
+
+	// Right shift to restore the original padding (restore non-fixed point).
+	nextDiffBig = nextDiffBig.Rsh(nextDiffBig, 32)
+
+	// Check to see if we're over the limits for the maximum allowable
+	// retarget.
+	switch {
+	case oldDiffBig.Sign() == 0:
+		// This should never really happen, keep the value as is.
+	case nextDiffBig.Sign() == 0:
+		nextDiffBig.Set(net.PowLimit)
+	case nextDiffBig.Cmp(nextDiffBigMax) > 0:
+		nextDiffBig.Set(nextDiffBigMax)
+	case nextDiffBig.Cmp(nextDiffBigMin) < 0:
+		nextDiffBig.Set(nextDiffBigMin)
+	}
+
+	// Limit new value to the proof of work limit.
+	if nextDiffBig.Cmp(net.PowLimit) > 0 {
+		nextDiffBig.Set(net.PowLimit)
+	}
+
+	return blockchain.BigToCompact(nextDiffBig)
+}
+
+// CalcNextRequiredStakeDifficulty calculates the stake difficulty of the
+// block following headers[0]. The headers are the tip followed by its
+// ancestors, newest first, as returned by FetchAncestors. This mirrors the
+// DCP0001 stake difficulty algorithm of dcrd.
+func CalcNextRequiredStakeDifficulty(headers []*wire.BlockHeader, net *chaincfg.Params) int64 {
+	// Stake difficulty before any tickets could possibly be purchased is
+	// the minimum value.
+	nextHeight := int64(0)
+	if len(headers) > 0 {
+		nextHeight = int64(headers[0].Height) + 1
+	}
+	stakeDiffStartHeight := int64(net.CoinbaseMaturity) + 1
+	if nextHeight < stakeDiffStartHeight {
+		return net.MinimumStakeDiff
+	}
+
+	// Return the previous block's difficulty requirements if the next
+	// block is not at a difficulty retarget interval.
+	curNode := headers[0]
+	intervalSize := net.StakeDiffWindowSize
+	curDiff := curNode.SBits
+	if nextHeight%intervalSize != 0 {
+		return curDiff
+	}
+
+	// Get the pool size and number of tickets that were immature at the
+	// previous retarget interval.
+	ticketMaturity := int64(net.TicketMaturity)
+	var prevPoolSize int64
+	prevRetargetHeight := nextHeight - intervalSize - 1
+	prevImmatureTickets := int64(0)
+	if prevRetargetHeight >= 0 {
+		if prevRetargetNode := ancestor(headers, prevRetargetHeight); prevRetargetNode != nil {
+			prevPoolSize = int64(prevRetargetNode.PoolSize)
+		}
+		prevImmatureTickets = sumPurchasedTickets(headers,
+			prevRetargetHeight, ticketMaturity)
+	}
+
+	// Return the existing ticket price for the first few intervals to
+	// avoid division by zero and encourage initial pool population.
+	prevPoolSizeAll := prevPoolSize + prevImmatureTickets
+	if prevPoolSizeAll == 0 {
+		return curDiff
+	}
+
+	// Count the number of currently immature tickets.
+	immatureTickets := sumPurchasedTickets(headers,
+		int64(curNode.Height), ticketMaturity)
+
+	// Calculate the difficulty by multiplying the old stake difficulty
+	// with two ratios that represent a force to counteract the relative
+	// change in the pool size and a restorative force to push the pool
+	// size towards the target value:
+	//
+	//                   curDiff * curPoolSizeAll^2
+	//   nextDiff = -----------------------------------
+	//              prevPoolSizeAll * targetPoolSizeAll
+	curPoolSizeAll := int64(curNode.PoolSize) + immatureTickets
+	votesPerBlock := int64(net.TicketsPerBlock)
+	ticketPoolSize := int64(net.TicketPoolSize)
+	targetPoolSizeAll := votesPerBlock * (ticketPoolSize + ticketMaturity)
+	curPoolSizeAllBig := big.NewInt(curPoolSizeAll)
+	nextDiffBig := big.NewInt(curDiff)
+	nextDiffBig.Mul(nextDiffBig, curPoolSizeAllBig)
+	nextDiffBig.Mul(nextDiffBig, curPoolSizeAllBig)
+	nextDiffBig.Div(nextDiffBig, big.NewInt(prevPoolSizeAll))
+	nextDiffBig.Div(nextDiffBig, big.NewInt(targetPoolSizeAll))
+
+	// Limit the new stake difficulty between the minimum allowed stake
+	// difficulty and a maximum value that is relative to the total supply.
+	nextDiff := nextDiffBig.Int64()
+	maximumStakeDiff := estimateSupply(net, nextHeight) / ticketPoolSize
+	if nextDiff > maximumStakeDiff {
+		nextDiff = maximumStakeDiff
+	}
+	if nextDiff < net.MinimumStakeDiff {
+		nextDiff = net.MinimumStakeDiff
+	}
+	return nextDiff
+}
+
+// sumPurchasedTickets returns the number of tickets purchased in the given
+// number of blocks ending at the block with the given height
+func sumPurchasedTickets(headers []*wire.BlockHeader, height int64, numToSum int64) int64 {
+	var numPurchased int64
+	for i := int64(0); i < numToSum && height-i >= 0; i++ {
+		node := ancestor(headers, height-i)
+		if node == nil {
+			break
+		}
+		numPurchased += int64(node.FreshStake)
+	}
+	return numPurchased
+}
+
+// estimateSupply returns an estimate of the coin supply for the provided block
+// height. This is primarily used in the stake difficulty algorithm and relies
+// on an estimate to simplify the necessary calculations.
+func estimateSupply(net *chaincfg.Params, height int64) int64 {
+	if height <= 0 {
+		return 0
+	}
+
+	// Estimate the supply by calculating the full block subsidy for each
+	// reduction interval and multiplying it the number of blocks in the
+	// interval then adding the subsidy produced by number of blocks in the
+	// current interval.
+	supply := net.BlockOneSubsidy()
+	reductions := height / net.SubsidyReductionInterval
+	subsidy := net.BaseSubsidy
+	for i := int64(0); i < reductions; i++ {
+		supply += net.SubsidyReductionInterval * subsidy
+
+		subsidy *= net.MulSubsidy
+		subsidy /= net.DivSubsidy
+	}
+	supply += (1 + height%net.SubsidyReductionInterval) * subsidy
+
+	// Blocks 0 and 1 have special subsidy amounts that have already been
+	// added above, so remove what their subsidies would have normally been
+	// which were also added above.
+	supply -= net.BaseSubsidy * 2
+
+	return supply
+}
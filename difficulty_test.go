@@ -0,0 +1,395 @@
+package dcrharness
+
+import (
+	"github.com/decred/dcrd/blockchain"
+	"github.com/decred/dcrd/chaincfg"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/wire"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// chainHeaders returns the headers from the given tip height down to the
+// genesis block, newest first, setting each of them up with the fill func
+func chainHeaders(tipHeight int64, fill func(h *wire.BlockHeader)) []*wire.BlockHeader {
+	headers := make([]*wire.BlockHeader, 0, tipHeight+1)
+	for height := tipHeight; height >= 0; height-- {
+		h := &wire.BlockHeader{Height: uint32(height)}
+		fill(h)
+		headers = append(headers, h)
+	}
+	return headers
+}
+
+func TestCalcNextRequiredDifficulty(t *testing.T) {
+	net := &chaincfg.MainNetParams
+	const bits = 0x1b0404cb
+	bitsBig := blockchain.CompactToBig(bits)
+	retargetTip := net.WorkDiffWindowSize*net.WorkDiffWindows*2 - 1
+	genesisTime := time.Unix(1454954400, 0)
+
+	// spaced returns headers mined the given interval apart
+	spaced := func(tipHeight int64, interval time.Duration) []*wire.BlockHeader {
+		return chainHeaders(tipHeight, func(h *wire.BlockHeader) {
+			h.Bits = bits
+			h.Timestamp = genesisTime.Add(time.Duration(h.Height) * interval)
+		})
+	}
+	scaled := func(mul, div int64) uint32 {
+		v := new(big.Int).Mul(bitsBig, big.NewInt(mul))
+		return blockchain.BigToCompact(v.Div(v, big.NewInt(div)))
+	}
+
+	tests := []struct {
+		name     string
+		headers  []*wire.BlockHeader
+		expected uint32
+	}{
+		{
+			name:     "no headers",
+			headers:  nil,
+			expected: net.PowLimitBits,
+		},
+		{
+			name:     "not at retarget",
+			headers:  spaced(retargetTip-1, net.TargetTimePerBlock),
+			expected: bits,
+		},
+		{
+			name:     "on target",
+			headers:  spaced(retargetTip, net.TargetTimePerBlock),
+			expected: bits,
+		},
+		{
+			name:     "twice as fast",
+			headers:  spaced(retargetTip, net.TargetTimePerBlock/2),
+			expected: scaled(1, 2),
+		},
+		{
+			name:     "twice as slow",
+			headers:  spaced(retargetTip, net.TargetTimePerBlock*2),
+			expected: scaled(2, 1),
+		},
+		{
+			name:     "too fast is limited",
+			headers:  spaced(retargetTip, time.Second),
+			expected: scaled(1, net.RetargetAdjustmentFactor),
+		},
+		{
+			name:     "too slow is limited",
+			headers:  spaced(retargetTip, net.TargetTimePerBlock*100),
+			expected: scaled(net.RetargetAdjustmentFactor, 1),
+		},
+		{
+			name:     "windows reaching genesis are on target",
+			headers:  spaced(net.WorkDiffWindowSize-1, time.Second),
+			expected: bits,
+		},
+	}
+
+	for _, test := range tests {
+		newBlockTime := genesisTime
+		if len(test.headers) > 0 {
+			newBlockTime = test.headers[0].Timestamp.Add(net.TargetTimePerBlock)
+		}
+		got := CalcNextRequiredDifficulty(test.headers, newBlockTime, net)
+		if got != test.expected {
+			t.Errorf("%v: got bits %08x, want %08x", test.name, got,
+				test.expected)
+		}
+	}
+}
+
+func TestCalcNextRequiredDifficultyReduceMin(t *testing.T) {
+	net := chaincfg.MainNetParams
+	net.ReduceMinDifficulty = true
+	net.MinDiffReductionTime = 10 * time.Minute
+	const bits = 0x1b0404cb
+	tipTime := time.Unix(1454954400, 0)
+	blocksPerRetarget := net.WorkDiffWindowSize * net.WorkDiffWindows
+
+	// the tip and its parent were mined at the minimum difficulty
+	headers := chainHeaders(blocksPerRetarget+2, func(h *wire.BlockHeader) {
+		h.Bits = bits
+		if int64(h.Height) > blocksPerRetarget {
+			h.Bits = net.PowLimitBits
+		}
+		h.Timestamp = tipTime
+	})
+
+	tests := []struct {
+		name         string
+		newBlockTime time.Time
+		expected     uint32
+	}{
+		{
+			name:         "within the reduction time",
+			newBlockTime: tipTime.Add(net.MinDiffReductionTime),
+			expected:     bits,
+		},
+		{
+			name:         "past the reduction time",
+			newBlockTime: tipTime.Add(net.MinDiffReductionTime + time.Second),
+			expected:     net.PowLimitBits,
+		},
+	}
+
+	for _, test := range tests {
+		got := CalcNextRequiredDifficulty(headers, test.newBlockTime, &net)
+		if got != test.expected {
+			t.Errorf("%v: got bits %08x, want %08x", test.name, got,
+				test.expected)
+		}
+	}
+}
+
+func TestCalcNextRequiredStakeDifficulty(t *testing.T) {
+	net := &chaincfg.MainNetParams
+	const curDiff = 5 * 1e8
+	ticketMaturity := int64(net.TicketMaturity)
+	targetPoolSizeAll := int64(net.TicketsPerBlock) *
+		(int64(net.TicketPoolSize) + ticketMaturity)
+	retargetTip := net.StakeDiffWindowSize*3 - 1
+
+	// pool returns headers with the given live pool size at the tip and
+	// before it
+	pool := func(tipHeight int64, tipPoolSize, poolSize int64) []*wire.BlockHeader {
+		return chainHeaders(tipHeight, func(h *wire.BlockHeader) {
+			h.SBits = curDiff
+			h.PoolSize = uint32(poolSize)
+			if int64(h.Height) == tipHeight {
+				h.PoolSize = uint32(tipPoolSize)
+			}
+		})
+	}
+
+	tests := []struct {
+		name     string
+		headers  []*wire.BlockHeader
+		expected int64
+	}{
+		{
+			name:     "no headers",
+			headers:  nil,
+			expected: net.MinimumStakeDiff,
+		},
+		{
+			name:     "before coinbase maturity",
+			headers:  pool(int64(net.CoinbaseMaturity)-1, 0, 0),
+			expected: net.MinimumStakeDiff,
+		},
+		{
+			name:     "not at retarget",
+			headers:  pool(retargetTip-1, targetPoolSizeAll*2, targetPoolSizeAll),
+			expected: curDiff,
+		},
+		{
+			name:     "empty pool",
+			headers:  pool(retargetTip, 0, 0),
+			expected: curDiff,
+		},
+		{
+			name:     "pool at target",
+			headers:  pool(retargetTip, targetPoolSizeAll, targetPoolSizeAll),
+			expected: curDiff,
+		},
+		{
+			name:     "pool doubled",
+			headers:  pool(retargetTip, targetPoolSizeAll*2, targetPoolSizeAll),
+			expected: curDiff * 4,
+		},
+		{
+			name:     "pool halved is limited by the minimum",
+			headers:  pool(retargetTip, targetPoolSizeAll/2, targetPoolSizeAll),
+			expected: net.MinimumStakeDiff,
+		},
+		{
+			name:     "pool tenfold is limited by the supply",
+			headers:  pool(retargetTip, targetPoolSizeAll*10, targetPoolSizeAll),
+			expected: estimateSupply(net, retargetTip+1) / int64(net.TicketPoolSize),
+		},
+		{
+			name: "immature tickets count toward the pool",
+			headers: chainHeaders(retargetTip, func(h *wire.BlockHeader) {
+				h.SBits = curDiff
+				h.FreshStake = uint8(targetPoolSizeAll / ticketMaturity)
+			}),
+			expected: curDiff,
+		},
+	}
+
+	for _, test := range tests {
+		got := CalcNextRequiredStakeDifficulty(test.headers, net)
+		if got != test.expected {
+			t.Errorf("%v: got stake difficulty %v, want %v", test.name,
+				got, test.expected)
+		}
+	}
+}
+
+func TestEstimateSupply(t *testing.T) {
+	net := &chaincfg.MainNetParams
+	baseSubsidy := net.BaseSubsidy
+	reduxInterval := net.SubsidyReductionInterval
+	blockOneSubsidy := net.BlockOneSubsidy()
+	reducedSubsidy := func(reductions int) int64 {
+		subsidy := baseSubsidy
+		for i := 0; i < reductions; i++ {
+			subsidy *= net.MulSubsidy
+			subsidy /= net.DivSubsidy
+		}
+		return subsidy
+	}
+
+	tests := []struct {
+		height   int64
+		expected int64
+	}{
+		{height: -1, expected: 0},
+		{height: 0, expected: 0},
+		{height: 1, expected: blockOneSubsidy},
+		{height: 2, expected: blockOneSubsidy + baseSubsidy},
+		{height: 3, expected: blockOneSubsidy + baseSubsidy*2},
+		{
+			height:   reduxInterval - 1,
+			expected: blockOneSubsidy + (reduxInterval-2)*baseSubsidy,
+		},
+		{
+			height: reduxInterval,
+			expected: blockOneSubsidy + (reduxInterval-2)*baseSubsidy +
+				reducedSubsidy(1),
+		},
+		{
+			height: reduxInterval + 1,
+			expected: blockOneSubsidy + (reduxInterval-2)*baseSubsidy +
+				reducedSubsidy(1)*2,
+		},
+		{
+			height: reduxInterval*2 - 1,
+			expected: blockOneSubsidy + (reduxInterval-2)*baseSubsidy +
+				reducedSubsidy(1)*reduxInterval,
+		},
+		{
+			height: reduxInterval * 2,
+			expected: blockOneSubsidy + (reduxInterval-2)*baseSubsidy +
+				reducedSubsidy(1)*reduxInterval + reducedSubsidy(2),
+		},
+	}
+
+	for _, test := range tests {
+		got := estimateSupply(net, test.height)
+		if got != test.expected {
+			t.Errorf("height %v: got supply %v, want %v", test.height,
+				got, test.expected)
+		}
+	}
+}
+
+func TestAncestorsRequiredAt(t *testing.T) {
+	net := &chaincfg.MainNetParams
+	reduceMin := chaincfg.MainNetParams
+	reduceMin.ReduceMinDifficulty = true
+	window := AncestorsRequired(net)
+
+	tests := []struct {
+		name      string
+		tipHeight int64
+		net       *chaincfg.Params
+		expected  int64
+	}{
+		{
+			name:      "off retarget",
+			tipHeight: net.StakeDiffWindowSize,
+			net:       net,
+			expected:  1,
+		},
+		{
+			name:      "work retarget",
+			tipHeight: net.WorkDiffWindowSize*3 - 1,
+			net:       net,
+			expected:  window,
+		},
+		{
+			name:      "stake retarget",
+			tipHeight: net.StakeDiffWindowSize*5 - 1,
+			net:       net,
+			expected:  window,
+		},
+		{
+			name:      "reduced minimum difficulty",
+			tipHeight: net.StakeDiffWindowSize,
+			net:       &reduceMin,
+			expected:  window,
+		},
+	}
+
+	for _, test := range tests {
+		got := AncestorsRequiredAt(test.tipHeight, test.net)
+		if got != test.expected {
+			t.Errorf("%v: got %v ancestors, want %v", test.name, got,
+				test.expected)
+		}
+	}
+}
+
+func TestCheckAncestors(t *testing.T) {
+	net := &chaincfg.MainNetParams
+	retargetTip := net.WorkDiffWindowSize*net.WorkDiffWindows*2 - 1
+	full := chainHeaders(retargetTip, func(h *wire.BlockHeader) {})
+	offTip := chainHeaders(net.StakeDiffWindowSize, func(h *wire.BlockHeader) {})
+	short := chainHeaders(net.WorkDiffWindowSize-1, func(h *wire.BlockHeader) {})
+	tipHash := func(headers []*wire.BlockHeader) *chainhash.Hash {
+		hash := headers[0].BlockHash()
+		return &hash
+	}
+
+	tests := []struct {
+		name     string
+		headers  []*wire.BlockHeader
+		prevHash *chainhash.Hash
+		wantErr  bool
+	}{
+		{
+			name:     "no ancestors",
+			headers:  nil,
+			prevHash: tipHash(full),
+			wantErr:  true,
+		},
+		{
+			name:     "other tip",
+			headers:  full,
+			prevHash: tipHash(offTip),
+			wantErr:  true,
+		},
+		{
+			name:     "tip only off retarget",
+			headers:  offTip[:1],
+			prevHash: tipHash(offTip),
+		},
+		{
+			name:     "tip only at retarget",
+			headers:  full[:1],
+			prevHash: tipHash(full),
+			wantErr:  true,
+		},
+		{
+			name:     "full window at retarget",
+			headers:  full[:AncestorsRequired(net)],
+			prevHash: tipHash(full),
+		},
+		{
+			name:     "short chain reaching genesis",
+			headers:  short,
+			prevHash: tipHash(short),
+		},
+	}
+
+	for _, test := range tests {
+		err := checkAncestors(test.headers, test.prevHash, net)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%v: got error %v, want error %v", test.name, err,
+				test.wantErr)
+		}
+	}
+}
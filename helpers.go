@@ -1,18 +1,19 @@
 package dcrharness
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"github.com/decred/dcrd/dcrutil"
-	"github.com/decred/dcrd/rpcclient"
 	"github.com/jfixby/coin"
 	"github.com/jfixby/coinharness"
 	"github.com/jfixby/pin"
-	"math/big"
+	"sort"
 	"time"
 
 	"github.com/decred/dcrd/blockchain"
+	"github.com/decred/dcrd/blockchain/stake"
 	"github.com/decred/dcrd/chaincfg"
 	"github.com/decred/dcrd/chaincfg/chainhash"
 	"github.com/decred/dcrd/txscript"
@@ -28,6 +29,27 @@ type GenerateBlockArgs struct {
 	MineTo        []wire.TxOut
 	MiningAddress dcrutil.Address
 	Network       *chaincfg.Params
+	// Stake holds the stake tree of the block and its stake-related
+	// header fields; nil produces a block with the regular tree only
+	Stake *BlockStake
+	// Context bounds the proof-of-work search, DefaultSolveTimeout
+	// applies when it is nil or has no deadline
+	Context context.Context
+}
+
+// BlockStake bundles the stake transactions (tickets, votes and revocations)
+// of a block together with the stake-related header fields that can not be
+// derived from the transactions themselves.
+type BlockStake struct {
+	// STxns are the SStx, SSGen and SSRtx transactions of the stake tree
+	STxns []*dcrutil.Tx
+	// VoteBits are the header vote bits, the block-valid bit is overridden
+	// by the majority of the included votes when there are any
+	VoteBits     uint16
+	StakeVersion uint32
+	PoolSize     uint32
+	FinalState   [6]byte
+	SBits        int64
 }
 
 // GenerateAndSubmitBlock creates a block whose contents include the passed
@@ -64,40 +86,123 @@ func GenerateAndSubmitBlockWithCustomCoinbaseOutputs(client coinharness.RPCClien
 
 	pin.AssertTrue("blockVersion != -1", blockVersion != -1)
 
-	prevBlockHash, prevBlockHeight, err := client.Internal().(*rpcclient.Client).GetBestBlock()
+	c, err := harnessClient(client)
+	if err != nil {
+		return nil, err
+	}
+	bestHash, prevBlockHeight, err := c.GetBestBlock()
 	if err != nil {
 		return nil, err
 	}
-	mBlock, err := client.Internal().(*rpcclient.Client).GetBlock(prevBlockHash)
+	prevBlockHash := bestHash.(*chainhash.Hash)
+	mBlock, err := c.rawBlock(prevBlockHash)
 	if err != nil {
 		return nil, err
 	}
 	prevBlock := dcrutil.NewBlock(mBlock)
 	mBlock.Header.Height = uint32(prevBlockHeight)
 
+	// The ancestors are only loaded when the tip does not carry
+	// the difficulties of the next block.
+	ancestors := []*wire.BlockHeader{&mBlock.Header}
+	if count := AncestorsRequiredAt(prevBlockHeight, network); count > 1 {
+		ancestors, err = FetchAncestors(client, prevBlockHash, count)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Create a new block including the specified transactions
-	newBlock, err := CreateBlock(prevBlock, txns, blockVersion,
-		blockTime, miningAddress, mineTo, network)
+	newBlock, err := CreateBlockWithArgs(&CreateBlockArgs{
+		PrevBlock:     prevBlock,
+		InclusionTxs:  txns,
+		BlockVersion:  blockVersion,
+		BlockTime:     blockTime,
+		MiningAddress: miningAddress,
+		MineTo:        mineTo,
+		Network:       network,
+		Ancestors:     ancestors,
+		Stake:         args.Stake,
+		Context:       args.Context,
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	// Submit the block to the simnet node.
-	if err := client.Internal().(*rpcclient.Client).SubmitBlock(newBlock, nil); err != nil {
+	if err := c.SubmitBlock(newBlock); err != nil {
 		return nil, err
 	}
 
 	return newBlock, nil
 }
 
+// CreateBlockArgs bundles CreateBlockWithArgs() arguments. The fields
+// up to Network are the CreateBlock() arguments.
+type CreateBlockArgs struct {
+	PrevBlock     *dcrutil.Block
+	InclusionTxs  []*dcrutil.Tx
+	BlockVersion  int32
+	BlockTime     time.Time
+	MiningAddress dcrutil.Address
+	MineTo        []wire.TxOut
+	Network       *chaincfg.Params
+	// Ancestors are the header of the previous block followed by the
+	// headers of its ancestors, newest first, as returned by
+	// FetchAncestors. They are used to compute the proof-of-work
+	// difficulty of the block and, unless set by Stake, its stake
+	// difficulty. AncestorsRequiredAt() tells how many are needed,
+	// they are ignored when PrevBlock is nil.
+	Ancestors []*wire.BlockHeader
+	// Stake holds the stake tree of the block and its stake-related
+	// header fields; nil produces a block with the regular tree only
+	Stake *BlockStake
+	// Context bounds the proof-of-work search, DefaultSolveTimeout
+	// applies when it is nil or has no deadline
+	Context context.Context
+}
+
 // CreateBlock creates a new block building from the previous block with a
 // specified blockversion and timestamp. If the timestamp passed is zero (not
 // initialized), then the timestamp of the previous block will be used plus 1
 // second is used. Passing nil for the previous block results in a block that
-// builds off of the genesis block for the specified chain.
+// builds off of the genesis block for the specified chain. The difficulty is
+// taken from the previous block, an error is returned at the retarget heights
+// where CreateBlockWithArgs() with the Ancestors is required.
 func CreateBlock(prevBlock *dcrutil.Block, inclusionTxs []*dcrutil.Tx,
 	blockVersion int32, blockTime time.Time, miningAddr dcrutil.Address,
 	mineTo []wire.TxOut, net *chaincfg.Params) (*dcrutil.Block, error) {
+	var ancestors []*wire.BlockHeader
+	if prevBlock != nil {
+		ancestors = []*wire.BlockHeader{&prevBlock.MsgBlock().Header}
+	}
+	return CreateBlockWithArgs(&CreateBlockArgs{
+		PrevBlock:     prevBlock,
+		Ancestors:     ancestors,
+		InclusionTxs:  inclusionTxs,
+		BlockVersion:  blockVersion,
+		BlockTime:     blockTime,
+		MiningAddress: miningAddr,
+		MineTo:        mineTo,
+		Network:       net,
+	})
+}
+
+// CreateBlockWithArgs is CreateBlock with the stake tree, the difficulty
+// ancestors and the proof-of-work context taken into account. An error is
+// returned when the context is done before the block is solved.
+func CreateBlockWithArgs(args *CreateBlockArgs) (*dcrutil.Block, error) {
+	prevBlock := args.PrevBlock
+	inclusionTxs := args.InclusionTxs
+	blockVersion := args.BlockVersion
+	blockTime := args.BlockTime
+	miningAddr := args.MiningAddress
+	mineTo := args.MineTo
+	net := args.Network
+	ancestors := args.Ancestors
+	blockStake := args.Stake
+	ctx, cancel := solveContext(args.Context)
+	defer cancel()
 
 	var (
 		prevHash      *chainhash.Hash
@@ -111,10 +216,14 @@ func CreateBlock(prevBlock *dcrutil.Block, inclusionTxs []*dcrutil.Tx,
 		prevHash = net.GenesisHash
 		blockHeight = 1
 		prevBlockTime = net.GenesisBlock.Header.Timestamp.Add(time.Minute)
+		ancestors = []*wire.BlockHeader{&net.GenesisBlock.Header}
 	} else {
 		prevHash = prevBlock.Hash()
 		blockHeight = (prevBlock.Height() + 1)
 		prevBlockTime = prevBlock.MsgBlock().Header.Timestamp
+		if err := checkAncestors(ancestors, prevHash, net); err != nil {
+			return nil, err
+		}
 	}
 
 	// If a target block time was specified, then use that as the header's
@@ -128,13 +237,32 @@ func CreateBlock(prevBlock *dcrutil.Block, inclusionTxs []*dcrutil.Tx,
 		ts = prevBlockTime.Add(time.Second)
 	}
 
+	if blockStake == nil {
+		blockStake = &BlockStake{VoteBits: dcrutil.BlockValid}
+	}
+	sbits := blockStake.SBits
+	if sbits == 0 {
+		sbits = CalcNextRequiredStakeDifficulty(ancestors, net)
+	}
+	tally, err := tallyStakeTxns(blockStake.STxns)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prior to stake validation height the block subsidy is not reduced
+	// by missing votes.
+	voters := net.TicketsPerBlock
+	if blockHeight >= net.StakeValidationHeight {
+		voters = tally.voters
+	}
+
 	extraNonce := uint64(0)
 	coinbaseScript, err := standardCoinbaseScript(blockHeight, extraNonce)
 	if err != nil {
 		return nil, err
 	}
 	coinbaseTx, err := createCoinbaseTx(coinbaseScript, blockHeight,
-		miningAddr, mineTo, net)
+		miningAddr, mineTo, voters, net)
 	if err != nil {
 		return nil, err
 	}
@@ -145,52 +273,183 @@ func CreateBlock(prevBlock *dcrutil.Block, inclusionTxs []*dcrutil.Tx,
 		blockTxns = append(blockTxns, inclusionTxs...)
 	}
 	merkles := blockchain.BuildMerkleTreeStore(blockTxns)
+	var stakeRoot chainhash.Hash
+	if len(blockStake.STxns) > 0 {
+		stakeMerkles := blockchain.BuildMerkleTreeStore(blockStake.STxns)
+		stakeRoot = *stakeMerkles[len(stakeMerkles)-1]
+	}
+
+	voteBits := blockStake.VoteBits
+	if tally.voters > 0 {
+		voteBits &^= dcrutil.BlockValid
+		if tally.approvals > tally.voters/2 {
+			voteBits |= dcrutil.BlockValid
+		}
+	}
+
 	var block wire.MsgBlock
 	block.Header = wire.BlockHeader{
-		Version:    blockVersion,
-		PrevBlock:  *prevHash,
-		MerkleRoot: *merkles[len(merkles)-1],
-		Timestamp:  ts,
-		Bits:       net.PowLimitBits,
+		Version:      blockVersion,
+		PrevBlock:    *prevHash,
+		MerkleRoot:   *merkles[len(merkles)-1],
+		StakeRoot:    stakeRoot,
+		VoteBits:     voteBits,
+		FinalState:   blockStake.FinalState,
+		Voters:       tally.voters,
+		FreshStake:   tally.freshStake,
+		Revocations:  tally.revocations,
+		PoolSize:     blockStake.PoolSize,
+		Timestamp:    ts,
+		Bits:         CalcNextRequiredDifficulty(ancestors, ts, net),
+		SBits:        sbits,
+		Height:       uint32(blockHeight),
+		StakeVersion: blockStake.StakeVersion,
 	}
 	for _, tx := range blockTxns {
 		if err := block.AddTransaction(tx.MsgTx()); err != nil {
 			return nil, err
 		}
 	}
+	for _, tx := range blockStake.STxns {
+		if err := block.AddSTransaction(tx.MsgTx()); err != nil {
+			return nil, err
+		}
+	}
+	block.Header.Size = uint32(block.SerializeSize())
 
-	found := solveBlock(&block.Header, net.PowLimit)
-	if !found {
-		return nil, errors.New("unable to solve block")
+	if err := SolveBlock(ctx, &block.Header); err != nil {
+		return nil, err
 	}
 
 	utilBlock := dcrutil.NewBlock(&block)
-	utilBlock.MsgBlock().Header.Height = uint32(blockHeight)
 	return utilBlock, nil
 }
 
-// solveBlock attempts to find a nonce which makes the passed block header hash
-// to a value less than the target difficulty. When a successful solution is
-// found true is returned and the nonce field of the passed header is updated
-// with the solution. False is returned if no solution exists.
-func solveBlock(header *wire.BlockHeader, targetDifficulty *big.Int) bool {
-	// Note that the entire extra nonce range is iterated and the offset is
-	// added relying on the fact that overflow will wrap around 0 as
-	// provided by the Go spec.
-	for i := uint32(0); ; i++ {
-		// Update the nonce and hash the block header.
-		header.Nonce = i
-		hash := header.BlockHash()
-		// The block is solved when the new block hash is less
-		// than the target difficulty.  Yay!
-		blockHash := blockchain.HashToBig(&hash)
-		if blockHash.Cmp(targetDifficulty) <= 0 {
-			pin.D("       blockHash", blockHash)
-			pin.D("targetDifficulty", targetDifficulty)
-			return true
+// stakeTally holds the stake-related header counters of a stake tree
+type stakeTally struct {
+	voters      uint16
+	approvals   uint16
+	freshStake  uint8
+	revocations uint8
+}
+
+// tallyStakeTxns counts tickets, votes and revocations of the passed stake
+// tree and tags every transaction as a stake tree member. Transactions of
+// any other type are rejected as they can not be put into the stake tree.
+func tallyStakeTxns(stxns []*dcrutil.Tx) (*stakeTally, error) {
+	tally := &stakeTally{}
+	for _, tx := range stxns {
+		switch stake.DetermineTxType(tx.MsgTx()) {
+		case stake.TxTypeSStx:
+			tally.freshStake++
+		case stake.TxTypeSSGen:
+			tally.voters++
+			if stake.SSGenVoteBits(tx.MsgTx())&dcrutil.BlockValid != 0 {
+				tally.approvals++
+			}
+		case stake.TxTypeSSRtx:
+			tally.revocations++
+		default:
+			return nil, fmt.Errorf("transaction %v is not a stake "+
+				"transaction", tx.Hash())
 		}
+		tx.SetTree(wire.TxTreeStake)
 	}
-	return false
+	return tally, nil
+}
+
+// NewBlockStake prepares the stake part of a block that builds on top of the
+// current best block of the node. The pool size and the final lottery state
+// are recomputed from the live tickets of the node, the stake difficulty is
+// the one the node expects for the next block. The stake version is copied
+// from the tip, set it by hand when the block crosses a stake version
+// interval that changes the expected version.
+func NewBlockStake(client coinharness.RPCClient, stxns []*dcrutil.Tx, net *chaincfg.Params) (*BlockStake, error) {
+	c, err := harnessClient(client)
+	if err != nil {
+		return nil, err
+	}
+	bestHash, _, err := c.GetBestBlock()
+	if err != nil {
+		return nil, err
+	}
+	header, err := c.GetBlockHeader(bestHash)
+	if err != nil {
+		return nil, err
+	}
+	tip := BlockHeaderToRaw(header)
+	live, err := c.LiveTickets()
+	if err != nil {
+		return nil, err
+	}
+	stakeDiff, err := c.GetStakeDifficulty()
+	if err != nil {
+		return nil, err
+	}
+	sbits := stakeDiff.NextStakeDifficulty.ToAtoms()
+
+	tickets := make([]chainhash.Hash, 0, len(live))
+	for _, t := range live {
+		tickets = append(tickets, *t.(*chainhash.Hash))
+	}
+	poolSize, finalState, _, err := CalcNextStakeState(tip, tickets, net)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlockStake{
+		STxns:        stxns,
+		VoteBits:     dcrutil.BlockValid,
+		StakeVersion: tip.StakeVersion,
+		PoolSize:     poolSize,
+		FinalState:   finalState,
+		SBits:        sbits,
+	}, nil
+}
+
+// CalcNextStakeState runs the ticket lottery of the passed tip block over its
+// live ticket pool. It returns the pool size and the final lottery state the
+// next block must commit to along with the tickets selected to vote on the
+// tip. The lottery only runs once the tip reaches the block before the stake
+// validation height, prior to that the final state is zero and no winners are
+// returned.
+func CalcNextStakeState(tip *wire.BlockHeader, liveTickets []chainhash.Hash,
+	net *chaincfg.Params) (uint32, [6]byte, []chainhash.Hash, error) {
+
+	var finalState [6]byte
+	poolSize := uint32(len(liveTickets))
+	if int64(tip.Height) < net.StakeValidationHeight-1 {
+		return poolSize, finalState, nil, nil
+	}
+
+	// The lottery picks tickets by their index in the pool sorted by hash.
+	sorted := make([]chainhash.Hash, len(liveTickets))
+	copy(sorted, liveTickets)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i][:], sorted[j][:]) < 0
+	})
+
+	headerBytes, err := tip.Bytes()
+	if err != nil {
+		return 0, finalState, nil, err
+	}
+	prng := stake.NewHash256PRNGFromIV(stake.CalcHash256PRNGIV(headerBytes))
+	idxs, err := stake.FindTicketIdxs(len(sorted), net.TicketsPerBlock, prng)
+	if err != nil {
+		return 0, finalState, nil, err
+	}
+
+	winners := make([]chainhash.Hash, 0, len(idxs))
+	stateBuffer := make([]byte, 0, (len(idxs)+1)*chainhash.HashSize)
+	for _, idx := range idxs {
+		winners = append(winners, sorted[idx])
+		stateBuffer = append(stateBuffer, sorted[idx][:]...)
+	}
+	lastHash := prng.StateHash()
+	stateBuffer = append(stateBuffer, lastHash[:]...)
+	copy(finalState[:], chainhash.HashB(stateBuffer)[0:6])
+
+	return poolSize, finalState, winners, nil
 }
 
 // standardCoinbaseScript returns a standard script suitable for use as the
@@ -206,9 +465,10 @@ func standardCoinbaseScript(nextBlockHeight int64, extraNonce uint64) ([]byte, e
 const TxTreeRegular int8 = 0
 
 // createCoinbaseTx returns a coinbase transaction paying an appropriate
-// subsidy based on the passed block height to the provided address.
+// subsidy based on the passed block height and the number of votes included
+// into the block to the provided address.
 func createCoinbaseTx(coinbaseScript []byte, nextBlockHeight int64,
-	addr dcrutil.Address, mineTo []wire.TxOut,
+	addr dcrutil.Address, mineTo []wire.TxOut, voters uint16,
 	params *chaincfg.Params) (*dcrutil.Tx, error) {
 
 	tx := wire.NewMsgTx()
@@ -253,7 +513,6 @@ func createCoinbaseTx(coinbaseScript []byte, nextBlockHeight int64,
 	}
 
 	subsidyCache := blockchain.NewSubsidyCache(0, params)
-	voters := params.TicketsPerBlock
 	// Create a coinbase with correct block subsidy and extranonce.
 	subsidy := blockchain.CalcBlockWorkSubsidy(subsidyCache,
 		nextBlockHeight,
@@ -0,0 +1,140 @@
+package dcrharness
+
+import (
+	"github.com/decred/dcrd/chaincfg"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/wire"
+	"testing"
+)
+
+// ticketPool returns the given number of distinct ticket hashes
+func ticketPool(size int) []chainhash.Hash {
+	tickets := make([]chainhash.Hash, 0, size)
+	for i := 0; i < size; i++ {
+		tickets = append(tickets, chainhash.HashH([]byte{byte(i), byte(i >> 8)}))
+	}
+	return tickets
+}
+
+func TestCalcNextStakeState(t *testing.T) {
+	net := &chaincfg.SimNetParams
+	lotteryHeight := uint32(net.StakeValidationHeight - 1)
+	perBlock := int(net.TicketsPerBlock)
+
+	tests := []struct {
+		name        string
+		height      uint32
+		tickets     int
+		wantLottery bool
+		wantErr     bool
+	}{
+		{
+			name:    "genesis",
+			height:  0,
+			tickets: 0,
+		},
+		{
+			name:    "before the lottery",
+			height:  lotteryHeight - 1,
+			tickets: perBlock * 4,
+		},
+		{
+			name:        "first lottery",
+			height:      lotteryHeight,
+			tickets:     perBlock * 4,
+			wantLottery: true,
+		},
+		{
+			name:        "later lottery",
+			height:      lotteryHeight + 100,
+			tickets:     perBlock * 40,
+			wantLottery: true,
+		},
+		{
+			name:    "pool smaller than the votes per block",
+			height:  lotteryHeight,
+			tickets: perBlock - 1,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		tip := &wire.BlockHeader{Height: test.height, Nonce: 7}
+		tickets := ticketPool(test.tickets)
+		poolSize, finalState, winners, err := CalcNextStakeState(tip, tickets, net)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%v: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.name, err)
+			continue
+		}
+		if poolSize != uint32(test.tickets) {
+			t.Errorf("%v: got pool size %v, want %v", test.name, poolSize,
+				test.tickets)
+		}
+		if !test.wantLottery {
+			if finalState != [6]byte{} || len(winners) != 0 {
+				t.Errorf("%v: lottery ran before the stake validation "+
+					"height", test.name)
+			}
+			continue
+		}
+
+		if finalState == [6]byte{} {
+			t.Errorf("%v: zero final state", test.name)
+		}
+		if len(winners) != perBlock {
+			t.Errorf("%v: got %v winners, want %v", test.name,
+				len(winners), perBlock)
+		}
+		pool := make(map[chainhash.Hash]bool, len(tickets))
+		for _, ticket := range tickets {
+			pool[ticket] = true
+		}
+		for _, winner := range winners {
+			if !pool[winner] {
+				t.Errorf("%v: winner %v is not in the pool", test.name,
+					winner)
+			}
+		}
+
+		// The lottery depends on the pool content, not on its order.
+		reversed := make([]chainhash.Hash, len(tickets))
+		for i, ticket := range tickets {
+			reversed[len(tickets)-1-i] = ticket
+		}
+		_, state, again, err := CalcNextStakeState(tip, reversed, net)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.name, err)
+			continue
+		}
+		if state != finalState {
+			t.Errorf("%v: final state depends on the pool order",
+				test.name)
+		}
+		for i := range winners {
+			if again[i] != winners[i] {
+				t.Errorf("%v: winners depend on the pool order",
+					test.name)
+				break
+			}
+		}
+
+		// The lottery is seeded by the tip header.
+		other := *tip
+		other.Nonce++
+		_, state, _, err = CalcNextStakeState(&other, tickets, net)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.name, err)
+			continue
+		}
+		if state == finalState {
+			t.Errorf("%v: final state does not depend on the tip",
+				test.name)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package dcrharness
+
+import (
+	"context"
+	"fmt"
+	"github.com/decred/dcrd/blockchain"
+	"github.com/decred/dcrd/blockchain/stake"
+	"github.com/decred/dcrd/chaincfg"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/txscript"
+	"github.com/decred/dcrd/wire"
+	"github.com/jfixby/coinharness"
+	"strings"
+	"time"
+)
+
+// BlockMutator alters a valid block built by CreateBlock to make it break
+// a single consensus rule. ErrorCode is the rule violation dcrd is expected
+// to report and Reason is the fragment of the rule error description dcrd
+// reports that violation with. Mutate returns an error when the block does
+// not meet the preconditions of the mutation.
+type BlockMutator struct {
+	Name      string
+	ErrorCode blockchain.ErrorCode
+	Reason    string
+	Mutate    func(block *wire.MsgBlock, net *chaincfg.Params) error
+	// keepRoots disables recalculation of the merkle roots after mutation
+	keepRoots bool
+}
+
+// BadMerkleRoot corrupts the regular tree merkle root in the header
+var BadMerkleRoot = &BlockMutator{
+	Name:      "bad merkle root",
+	ErrorCode: blockchain.ErrBadMerkleRoot,
+	Reason:    "block merkle root is invalid",
+	keepRoots: true,
+	Mutate: func(block *wire.MsgBlock, net *chaincfg.Params) error {
+		block.Header.MerkleRoot[0] ^= 0xff
+		return nil
+	},
+}
+
+// WrongCoinbaseHeight makes the coinbase commit to the next block height
+var WrongCoinbaseHeight = &BlockMutator{
+	Name:      "wrong coinbase height",
+	ErrorCode: blockchain.ErrCoinbaseHeight,
+	Reason:    "wrong height in coinbase",
+	Mutate: func(block *wire.MsgBlock, net *chaincfg.Params) error {
+		wrongHeight := int64(block.Header.Height) + 1
+		coinbase := block.Transactions[0]
+		sigScript, err := standardCoinbaseScript(wrongHeight, 0)
+		if err != nil {
+			return err
+		}
+		coinbase.TxIn[0].SignatureScript = sigScript
+		random, err := wire.RandomUint64()
+		if err != nil {
+			return err
+		}
+		opReturn, err := standardCoinbaseOpReturn(wrongHeight, random)
+		if err != nil {
+			return err
+		}
+		coinbase.TxOut[1].PkScript = opReturn
+		return nil
+	},
+}
+
+// OversizeSubsidy makes the coinbase pay one atom more than allowed
+var OversizeSubsidy = &BlockMutator{
+	Name:      "oversize coinbase subsidy",
+	ErrorCode: blockchain.ErrBadCoinbaseValue,
+	Reason:    "which is more than expected value",
+	Mutate: func(block *wire.MsgBlock, net *chaincfg.Params) error {
+		coinbase := block.Transactions[0]
+		coinbase.TxOut[len(coinbase.TxOut)-1].Value++
+		return nil
+	},
+}
+
+// BadTimestamp moves the block timestamp too far into the future
+var BadTimestamp = &BlockMutator{
+	Name:      "bad timestamp",
+	ErrorCode: blockchain.ErrTimeTooNew,
+	Reason:    "too far in the future",
+	Mutate: func(block *wire.MsgBlock, net *chaincfg.Params) error {
+		block.Header.Timestamp = time.Unix(time.Now().Add(3*time.Hour).Unix(), 0)
+		return nil
+	},
+}
+
+// DuplicateTransaction repeats the last regular transaction of the block,
+// the block must contain a transaction besides the coinbase
+var DuplicateTransaction = &BlockMutator{
+	Name:      "duplicate transaction",
+	ErrorCode: blockchain.ErrDuplicateTx,
+	Reason:    "block contains duplicate transaction",
+	Mutate: func(block *wire.MsgBlock, net *chaincfg.Params) error {
+		if len(block.Transactions) < 2 {
+			return fmt.Errorf("block has no transactions to duplicate")
+		}
+		last := block.Transactions[len(block.Transactions)-1]
+		return block.AddTransaction(last.Copy())
+	},
+}
+
+// WrongTaxOutput redirects the coinbase tax output away from the
+// organization script
+var WrongTaxOutput = &BlockMutator{
+	Name:      "wrong tax output",
+	ErrorCode: blockchain.ErrNoTax,
+	Reason:    "coinbase tax output script does not match",
+	Mutate: func(block *wire.MsgBlock, net *chaincfg.Params) error {
+		trueScript, err := txscript.NewScriptBuilder().
+			AddOp(txscript.OP_TRUE).AddOp(txscript.OP_TRUE).Script()
+		if err != nil {
+			return err
+		}
+		block.Transactions[0].TxOut[0].PkScript = trueScript
+		return nil
+	},
+}
+
+// MissingVotes removes all votes from the stake tree of the block. dcrd
+// checks the votes from the stake validation height on only, the mutation
+// fails for the blocks below it.
+var MissingVotes = &BlockMutator{
+	Name:      "missing votes",
+	ErrorCode: blockchain.ErrNotEnoughVotes,
+	Reason:    "does not commit to enough votes",
+	Mutate: func(block *wire.MsgBlock, net *chaincfg.Params) error {
+		if int64(block.Header.Height) < net.StakeValidationHeight {
+			return fmt.Errorf("block at height %v is below the stake "+
+				"validation height %v", block.Header.Height,
+				net.StakeValidationHeight)
+		}
+		stxns := []*wire.MsgTx{}
+		for _, tx := range block.STransactions {
+			if !stake.IsSSGen(tx) {
+				stxns = append(stxns, tx)
+			}
+		}
+		block.STransactions = stxns
+		block.Header.Voters = 0
+		return nil
+	},
+}
+
+// WrongHeight makes the header claim the next block height
+var WrongHeight = &BlockMutator{
+	Name:      "wrong height",
+	ErrorCode: blockchain.ErrBadBlockHeight,
+	Reason:    "does not match chain height",
+	Mutate: func(block *wire.MsgBlock, net *chaincfg.Params) error {
+		block.Header.Height++
+		return nil
+	},
+}
+
+// BlockMutators lists all the predefined mutators
+var BlockMutators = []*BlockMutator{
+	BadMerkleRoot,
+	WrongCoinbaseHeight,
+	OversizeSubsidy,
+	BadTimestamp,
+	DuplicateTransaction,
+	WrongTaxOutput,
+	MissingVotes,
+	WrongHeight,
+}
+
+// InvalidBlock applies the mutator to a copy of the valid block. The merkle
+// roots and the size of the mutated block are recalculated, unless the
+// mutation targets them, and its proof of work is solved again so that the
+// node rejects the block for the mutated rule only. The error code dcrd is
+// expected to reject the block with is returned along with the block.
+// The context bounds the proof-of-work search, DefaultSolveTimeout applies
+// when it has no deadline.
+func InvalidBlock(ctx context.Context, valid *dcrutil.Block, m *BlockMutator, net *chaincfg.Params) (*dcrutil.Block, blockchain.ErrorCode, error) {
+	block, err := copyMsgBlock(valid.MsgBlock())
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := m.Mutate(block, net); err != nil {
+		return nil, 0, fmt.Errorf("%v: %v", m.Name, err)
+	}
+
+	if !m.keepRoots {
+		utilBlock := dcrutil.NewBlock(block)
+		merkles := blockchain.BuildMerkleTreeStore(utilBlock.Transactions())
+		block.Header.MerkleRoot = *merkles[len(merkles)-1]
+		if len(block.STransactions) > 0 {
+			stakeMerkles := blockchain.BuildMerkleTreeStore(utilBlock.STransactions())
+			block.Header.StakeRoot = *stakeMerkles[len(stakeMerkles)-1]
+		} else {
+			block.Header.StakeRoot = chainhash.Hash{}
+		}
+	}
+	block.Header.Size = uint32(block.SerializeSize())
+
+	ctx, cancel := solveContext(ctx)
+	defer cancel()
+	if err := SolveBlock(ctx, &block.Header); err != nil {
+		return nil, 0, err
+	}
+	return dcrutil.NewBlock(block), m.ErrorCode, nil
+}
+
+// copyMsgBlock returns a deep copy of the block
+func copyMsgBlock(block *wire.MsgBlock) (*wire.MsgBlock, error) {
+	bytes, err := block.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	result := &wire.MsgBlock{}
+	if err := result.FromBytes(bytes); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// AssertBlockRejected submits the invalid block and returns an error unless
+// the node rejects it for the rule broken by the mutator. submitblock reports
+// the rejection as "rejected: " followed by the rule error description, which
+// does not carry the ErrorCode, so the message is matched against the
+// mutator Reason.
+func AssertBlockRejected(client coinharness.RPCClient, block *dcrutil.Block, m *BlockMutator) error {
+	err := client.SubmitBlock(block)
+	if err == nil {
+		return fmt.Errorf("block with %v (%v) was accepted", m.Name,
+			m.ErrorCode)
+	}
+	if !strings.Contains(err.Error(), m.Reason) {
+		return fmt.Errorf("block with %v was rejected for unexpected "+
+			"reason, want %v: %v", m.Name, m.ErrorCode, err)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package dcrharness
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"github.com/decred/dcrd/blockchain"
+	"github.com/decred/dcrd/chaincfg"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/wire"
+	"testing"
+	"time"
+)
+
+// mutatorBlock returns a block at the given height holding a coinbase,
+// and the passed number of other regular transactions, and a stake tree
+// with a single transaction that is not a vote
+func mutatorBlock(t *testing.T, height int64, txns int, net *chaincfg.Params) *wire.MsgBlock {
+	coinbaseScript, err := standardCoinbaseScript(height, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase, err := createCoinbaseTx(coinbaseScript, height, nil, nil,
+		net.TicketsPerBlock, net)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := wire.NewMsgBlock(&wire.BlockHeader{
+		Height:    uint32(height),
+		Voters:    net.TicketsPerBlock,
+		Bits:      net.PowLimitBits,
+		Timestamp: time.Unix(1454954400, 0),
+	})
+	if err := block.AddTransaction(coinbase.MsgTx()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < txns; i++ {
+		tx := wire.NewMsgTx()
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: *wire.NewOutPoint(heightHash(int64(i)), 0,
+				wire.TxTreeRegular),
+			Sequence: wire.MaxTxInSequenceNum,
+		})
+		tx.AddTxOut(wire.NewTxOut(dcrutil.AtomsPerCoin, []byte{0x51}))
+		if err := block.AddTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stx := wire.NewMsgTx()
+	stx.AddTxOut(wire.NewTxOut(dcrutil.AtomsPerCoin, []byte{0x51}))
+	if err := block.AddSTransaction(stx); err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+func TestBlockMutators(t *testing.T) {
+	net := &chaincfg.SimNetParams
+	height := net.StakeValidationHeight
+
+	tests := []struct {
+		name    string
+		m       *BlockMutator
+		height  int64
+		txns    int
+		wantErr bool
+		// mutated reports whether the mutation was applied
+		mutated func(valid, block *wire.MsgBlock) bool
+	}{
+		{
+			name:   "bad merkle root",
+			m:      BadMerkleRoot,
+			height: height,
+			mutated: func(valid, block *wire.MsgBlock) bool {
+				return block.Header.MerkleRoot != valid.Header.MerkleRoot
+			},
+		},
+		{
+			name:   "wrong coinbase height",
+			m:      WrongCoinbaseHeight,
+			height: height,
+			mutated: func(valid, block *wire.MsgBlock) bool {
+				script := block.Transactions[0].TxOut[1].PkScript
+				return binary.LittleEndian.Uint32(script[2:6]) ==
+					uint32(height+1)
+			},
+		},
+		{
+			name:   "oversize coinbase subsidy",
+			m:      OversizeSubsidy,
+			height: height,
+			mutated: func(valid, block *wire.MsgBlock) bool {
+				last := len(valid.Transactions[0].TxOut) - 1
+				return block.Transactions[0].TxOut[last].Value ==
+					valid.Transactions[0].TxOut[last].Value+1
+			},
+		},
+		{
+			name:   "bad timestamp",
+			m:      BadTimestamp,
+			height: height,
+			mutated: func(valid, block *wire.MsgBlock) bool {
+				return block.Header.Timestamp.After(time.Now().Add(2 * time.Hour))
+			},
+		},
+		{
+			name:   "duplicate transaction",
+			m:      DuplicateTransaction,
+			height: height,
+			txns:   1,
+			mutated: func(valid, block *wire.MsgBlock) bool {
+				n := len(block.Transactions)
+				return n == len(valid.Transactions)+1 &&
+					block.Transactions[n-1].TxHash() ==
+						block.Transactions[n-2].TxHash()
+			},
+		},
+		{
+			name:    "duplicate transaction without transactions",
+			m:       DuplicateTransaction,
+			height:  height,
+			wantErr: true,
+		},
+		{
+			name:   "wrong tax output",
+			m:      WrongTaxOutput,
+			height: height,
+			mutated: func(valid, block *wire.MsgBlock) bool {
+				return !bytes.Equal(block.Transactions[0].TxOut[0].PkScript,
+					net.OrganizationPkScript)
+			},
+		},
+		{
+			name:   "missing votes",
+			m:      MissingVotes,
+			height: height,
+			mutated: func(valid, block *wire.MsgBlock) bool {
+				return block.Header.Voters == 0 &&
+					len(block.STransactions) == len(valid.STransactions)
+			},
+		},
+		{
+			name:    "missing votes below the stake validation height",
+			m:       MissingVotes,
+			height:  height - 1,
+			wantErr: true,
+		},
+		{
+			name:   "wrong height",
+			m:      WrongHeight,
+			height: height,
+			mutated: func(valid, block *wire.MsgBlock) bool {
+				return block.Header.Height == valid.Header.Height+1
+			},
+		},
+	}
+
+	for _, test := range tests {
+		valid := mutatorBlock(t, test.height, test.txns, net)
+		block, code, err := InvalidBlock(context.Background(),
+			dcrutil.NewBlock(valid), test.m, net)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%v: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.name, err)
+			continue
+		}
+		if code != test.m.ErrorCode {
+			t.Errorf("%v: got error code %v, want %v", test.name, code,
+				test.m.ErrorCode)
+		}
+		mutated := block.MsgBlock()
+		if !test.mutated(valid, mutated) {
+			t.Errorf("%v: mutation is not applied", test.name)
+		}
+
+		// The merkle roots are kept in line with the mutated trees
+		// unless the mutation targets them.
+		merkles := blockchain.BuildMerkleTreeStore(block.Transactions())
+		stakeMerkles := blockchain.BuildMerkleTreeStore(block.STransactions())
+		rootsMatch := mutated.Header.MerkleRoot == *merkles[len(merkles)-1] &&
+			mutated.Header.StakeRoot == *stakeMerkles[len(stakeMerkles)-1]
+		if rootsMatch == test.m.keepRoots {
+			t.Errorf("%v: got matching merkle roots %v, want %v",
+				test.name, rootsMatch, !test.m.keepRoots)
+		}
+		if mutated.Header.Size != uint32(mutated.SerializeSize()) {
+			t.Errorf("%v: got header size %v, want %v", test.name,
+				mutated.Header.Size, mutated.SerializeSize())
+		}
+		hash := mutated.Header.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(
+			blockchain.CompactToBig(mutated.Header.Bits)) > 0 {
+			t.Errorf("%v: proof of work is not solved", test.name)
+		}
+	}
+}
+
+func TestInvalidBlockKeepsValid(t *testing.T) {
+	net := &chaincfg.SimNetParams
+	valid := mutatorBlock(t, net.StakeValidationHeight, 1, net)
+	before, err := valid.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range BlockMutators {
+		if _, _, err := InvalidBlock(context.Background(),
+			dcrutil.NewBlock(valid), m, net); err != nil {
+			t.Errorf("%v: unexpected error: %v", m.Name, err)
+		}
+	}
+	after, err := valid.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Errorf("mutators altered the valid block")
+	}
+}
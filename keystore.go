@@ -0,0 +1,89 @@
+package dcrharness
+
+import (
+	"fmt"
+	"github.com/decred/dcrd/chaincfg"
+	"github.com/decred/dcrd/dcrec/secp256k1"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/jfixby/coinharness"
+	"sync"
+)
+
+// KeyStore maps p2pkh addresses to the private keys controlling them.
+// Stake transaction builders use it to sign on behalf of the harness.
+// KeyStore is safe for concurrent access.
+type KeyStore struct {
+	mtx  sync.RWMutex
+	net  *chaincfg.Params
+	keys map[string]*secp256k1.PrivateKey
+}
+
+// NewKeyStore creates an empty KeyStore for the given network
+func NewKeyStore(net *chaincfg.Params) *KeyStore {
+	return &KeyStore{
+		net:  net,
+		keys: make(map[string]*secp256k1.PrivateKey),
+	}
+}
+
+// WalletKeyStore creates a KeyStore holding keys for every address
+// generated so far by the InMemoryWallet. Keys are derived from the
+// wallet's HdRoot using the address index as the child number.
+func WalletKeyStore(wallet *coinharness.InMemoryWallet) (*KeyStore, error) {
+	store := NewKeyStore(wallet.Net.Params().(*chaincfg.Params))
+	for index := range wallet.Addrs {
+		key, err := WalletPrivateKey(wallet, index)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := store.AddKey(key); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// WalletPrivateKey derives the private key of the InMemoryWallet
+// address with the given index
+func WalletPrivateKey(wallet *coinharness.InMemoryWallet, index uint32) (*secp256k1.PrivateKey, error) {
+	child, err := wallet.HdRoot.Child(index)
+	if err != nil {
+		return nil, err
+	}
+	key, err := child.PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return key.(*PrivateKey).legacy, nil
+}
+
+// AddKey registers the key and returns the p2pkh address it controls
+func (s *KeyStore) AddKey(key *secp256k1.PrivateKey) (dcrutil.Address, error) {
+	addr, err := keyToAddr(key, s.net)
+	if err != nil {
+		return nil, err
+	}
+	s.mtx.Lock()
+	s.keys[addr.EncodeAddress()] = key
+	s.mtx.Unlock()
+	return addr, nil
+}
+
+// Key returns the private key controlling the given address
+func (s *KeyStore) Key(addr dcrutil.Address) (*secp256k1.PrivateKey, error) {
+	s.mtx.RLock()
+	key, ok := s.keys[addr.EncodeAddress()]
+	s.mtx.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no key for address %v", addr)
+	}
+	return key, nil
+}
+
+// HasKey reports whether the store controls the given address
+func (s *KeyStore) HasKey(addr dcrutil.Address) bool {
+	s.mtx.RLock()
+	_, ok := s.keys[addr.EncodeAddress()]
+	s.mtx.RUnlock()
+	return ok
+}
@@ -0,0 +1,55 @@
+package dcrharness
+
+import (
+	"github.com/decred/dcrd/dcrjson"
+	"github.com/jfixby/coin"
+)
+
+// TxAcceptedVerbose is the harness representation of the verbose
+// transaction-accepted notification. Fee is the difference between
+// the input and the output amounts, Size is the serialized size of
+// the transaction.
+type TxAcceptedVerbose struct {
+	*TxRawResult
+	Fee  coin.Amount
+	Size int
+}
+
+// ConvertTxAcceptedVerbose converts the handler into the
+// rpcclient.NotificationHandlers OnTxAcceptedVerbose callback,
+// nil handler is converted into nil callback. Notifications failing
+// the conversion are dropped, NewTxAcceptedVerbose reports the
+// conversion error.
+func ConvertTxAcceptedVerbose(handler func(tx *TxAcceptedVerbose)) func(*dcrjson.TxRawResult) {
+	if handler == nil {
+		return nil
+	}
+	return func(legacy *dcrjson.TxRawResult) {
+		tx, err := NewTxAcceptedVerbose(legacy)
+		if err != nil {
+			return
+		}
+		handler(tx)
+	}
+}
+
+// NewTxAcceptedVerbose converts the verbose notification payload
+func NewTxAcceptedVerbose(legacy *dcrjson.TxRawResult) (*TxAcceptedVerbose, error) {
+	r, err := convertTxRawResult(legacy)
+	if err != nil {
+		return nil, err
+	}
+	result := &TxAcceptedVerbose{TxRawResult: r}
+	var fee int64
+	for _, in := range r.Vin {
+		fee += in.AmountIn.ToAtoms()
+	}
+	for _, out := range r.Vout {
+		fee -= out.Value.ToAtoms()
+	}
+	result.Fee = coin.Amount{fee}
+	if r.Tx != nil {
+		result.Size = TransactionTxToRaw(r.Tx).SerializeSize()
+	}
+	return result, nil
+}
@@ -0,0 +1,136 @@
+package dcrharness
+
+import (
+	"context"
+	"fmt"
+	"github.com/jfixby/coinharness"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// peerPollInterval is the delay between peer info requests
+// of the peer waiting helpers
+const peerPollInterval = 100 * time.Millisecond
+
+// PeerInfo is the harness representation of the dcrd peer connection details
+type PeerInfo struct {
+	coinharness.PeerInfo
+	ID             int32
+	AddrLocal      string
+	Services       string
+	RelayTxes      bool
+	LastSend       int64
+	LastRecv       int64
+	BytesSent      uint64
+	BytesRecv      uint64
+	ConnTime       int64
+	TimeOffset     int64
+	PingTime       float64
+	PingWait       float64
+	Version        uint32
+	SubVer         string
+	Inbound        bool
+	StartingHeight int64
+	CurrentHeight  int64
+	BanScore       int32
+	SyncNode       bool
+}
+
+// WaitForPeerHeight blocks until the peer with the given address reports
+// the given height or more. An error is returned when the context is done
+// first.
+func (c *RPCClient) WaitForPeerHeight(ctx context.Context, addr string, height int64) error {
+	return c.waitForPeers(ctx, func(peers []*PeerInfo) bool {
+		for _, p := range peers {
+			if p.Addr == addr && p.CurrentHeight >= height {
+				return true
+			}
+		}
+		return false
+	}, fmt.Sprintf("peer %v to reach height %v", addr, height))
+}
+
+// WaitForPeerTopology blocks until the node is connected to exactly the
+// peers with the given addresses. Inbound peers connect from ephemeral
+// ports, so only the host of their address is compared. An error is
+// returned when the context is done first.
+func (c *RPCClient) WaitForPeerTopology(ctx context.Context, addrs []string) error {
+	expected := make([]string, len(addrs))
+	copy(expected, addrs)
+	sort.Strings(expected)
+
+	return c.waitForPeers(ctx, func(peers []*PeerInfo) bool {
+		return matchPeerTopology(peers, expected)
+	}, fmt.Sprintf("peers %v", strings.Join(expected, ",")))
+}
+
+// matchPeerTopology reports whether every peer matches a distinct address.
+// Outbound peers are matched by the full address first, inbound peers
+// take the remaining addresses by host.
+func matchPeerTopology(peers []*PeerInfo, addrs []string) bool {
+	if len(peers) != len(addrs) {
+		return false
+	}
+	left := make(map[string]int)
+	for _, a := range addrs {
+		left[a]++
+	}
+	inbound := []*PeerInfo{}
+	for _, p := range peers {
+		if p.Inbound {
+			inbound = append(inbound, p)
+			continue
+		}
+		if left[p.Addr] == 0 {
+			return false
+		}
+		left[p.Addr]--
+	}
+	for _, p := range inbound {
+		host := addrHost(p.Addr)
+		matched := false
+		for a, n := range left {
+			if n > 0 && addrHost(a) == host {
+				left[a]--
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// addrHost returns the host part of the address, the address itself
+// when it has no port
+func addrHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// waitForPeers polls the peer info until the condition is met
+func (c *RPCClient) waitForPeers(ctx context.Context, condition func([]*PeerInfo) bool, what string) error {
+	ticker := time.NewTicker(peerPollInterval)
+	defer ticker.Stop()
+	for {
+		peers, err := c.GetPeerInfoFull()
+		if err != nil {
+			return err
+		}
+		if condition(peers) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timeout waiting for %v: %v", what, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package dcrharness
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/decred/dcrd/blockchain"
+	"github.com/decred/dcrd/wire"
+	"math"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// DefaultSolveTimeout bounds the proof-of-work search of the block
+// building helpers when the passed context has no deadline
+const DefaultSolveTimeout = 5 * time.Minute
+
+// solveCheckInterval is the number of nonces a solver worker tries
+// between the context cancellation checks
+const solveCheckInterval = 1 << 16
+
+// SolveBlock searches for a nonce making the header hash to a value not
+// greater than the target difficulty encoded in the header Bits. The search
+// is split across GOMAXPROCS workers. Each worker owns a distinct extra nonce
+// stored in the first 8 bytes of the header ExtraData and rolls it forward
+// once its 32-bit nonce space is exhausted. When a solution is found the
+// Nonce and ExtraData of the passed header are updated, otherwise the error
+// of the context is reported.
+func SolveBlock(ctx context.Context, header *wire.BlockHeader) error {
+	target := blockchain.CompactToBig(header.Bits)
+	workers := runtime.GOMAXPROCS(0)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	solutions := make(chan *wire.BlockHeader, workers)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(extraNonce uint64) {
+			defer wg.Done()
+			h := *header
+			for ; ; extraNonce += uint64(workers) {
+				binary.LittleEndian.PutUint64(h.ExtraData[0:8], extraNonce)
+				for nonce := uint32(0); ; nonce++ {
+					if nonce%solveCheckInterval == 0 && ctx.Err() != nil {
+						return
+					}
+					h.Nonce = nonce
+					hash := h.BlockHash()
+					if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+						solutions <- &h
+						cancel()
+						return
+					}
+					if nonce == math.MaxUint32 {
+						break
+					}
+				}
+			}
+		}(uint64(i))
+	}
+	wg.Wait()
+
+	select {
+	case solved := <-solutions:
+		header.Nonce = solved.Nonce
+		header.ExtraData = solved.ExtraData
+		return nil
+	default:
+		return fmt.Errorf("unable to solve block: %w", ctx.Err())
+	}
+}
+
+// solveContext returns the context bounding the proof-of-work search of
+// the block building helpers. Nil stands for context.Background(), and
+// DefaultSolveTimeout applies unless the context has its own deadline.
+func solveContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, DefaultSolveTimeout)
+}
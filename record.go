@@ -0,0 +1,420 @@
+package dcrharness
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/wire"
+	"github.com/jfixby/coin"
+	"github.com/jfixby/coinharness"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of the recorded entries
+const (
+	RecordRequest      = "request"
+	RecordResponse     = "response"
+	RecordError        = "error"
+	RecordNotification = "notification"
+)
+
+// RecordEntry is a single line of the recording file. Responses and errors
+// share Seq with the request they answer. Client tells the connections
+// sharing the file apart, it is empty for the untagged recorder.
+type RecordEntry struct {
+	Time   time.Time
+	Client string `json:",omitempty"`
+	Kind   string
+	Seq    uint64
+	Method string
+	Params json.RawMessage `json:",omitempty"`
+	Result json.RawMessage `json:",omitempty"`
+	Error  string          `json:",omitempty"`
+}
+
+// Recorder writes RPC requests, responses, errors and notifications
+// to a JSON-lines file. Recorders returned by ForClient() share the file
+// and tag the entries they write.
+type Recorder struct {
+	log    *recordLog
+	client string
+}
+
+// recordLog is the file shared by the recorders of the connections
+type recordLog struct {
+	mtx  sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+	seq  uint64
+	err  error
+}
+
+// NewRecorder creates the recording file, an existing file is truncated
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{
+		log: &recordLog{
+			file: file,
+			enc:  json.NewEncoder(file),
+		},
+	}, nil
+}
+
+// ForClient returns the recorder writing to the same file and tagging
+// the entries with the given client id, e.g. the host of the node
+func (r *Recorder) ForClient(client string) *Recorder {
+	return &Recorder{log: r.log, client: client}
+}
+
+// Close closes the recording file and returns the first write error if any
+func (r *Recorder) Close() error {
+	l := r.log
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	err := l.file.Close()
+	if l.err != nil {
+		return l.err
+	}
+	return err
+}
+
+// Request records the request and returns its sequence number
+func (r *Recorder) Request(method string, params ...interface{}) uint64 {
+	l := r.log
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.seq++
+	r.write(&RecordEntry{
+		Kind:   RecordRequest,
+		Seq:    l.seq,
+		Method: method,
+		Params: r.marshal(recordParams(params)),
+	})
+	return l.seq
+}
+
+// Response records the result of the request or the error it failed with
+func (r *Recorder) Response(seq uint64, method string, result interface{}, err error) {
+	r.log.mtx.Lock()
+	defer r.log.mtx.Unlock()
+	entry := &RecordEntry{
+		Kind:   RecordResponse,
+		Seq:    seq,
+		Method: method,
+	}
+	if err != nil {
+		entry.Kind = RecordError
+		entry.Error = err.Error()
+	} else if result != nil {
+		entry.Result = r.marshal(recordValue(result))
+	}
+	r.write(entry)
+}
+
+// Notification records the notification handler call
+func (r *Recorder) Notification(handler string, params ...interface{}) {
+	r.log.mtx.Lock()
+	defer r.log.mtx.Unlock()
+	r.write(&RecordEntry{
+		Kind:   RecordNotification,
+		Method: handler,
+		Params: r.marshal(recordParams(params)),
+	})
+}
+
+// marshal and write are called with the log mutex held
+func (r *Recorder) marshal(v interface{}) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil && r.log.err == nil {
+		r.log.err = err
+	}
+	return b
+}
+
+func (r *Recorder) write(entry *RecordEntry) {
+	entry.Time = time.Now()
+	entry.Client = r.client
+	if err := r.log.enc.Encode(entry); err != nil && r.log.err == nil {
+		r.log.err = err
+	}
+}
+
+func recordParams(params []interface{}) []interface{} {
+	if len(params) == 0 {
+		return nil
+	}
+	result := []interface{}{}
+	for _, p := range params {
+		result = append(result, recordValue(p))
+	}
+	return result
+}
+
+// recordValue converts hashes, addresses, transactions and blocks
+// into their string form, structs, slices and maps are converted
+// element by element, other values are recorded as is
+func recordValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case *chainhash.Hash:
+		if x == nil {
+			return nil
+		}
+		return x.String()
+	case chainhash.Hash:
+		return x.String()
+	case []coinharness.Hash:
+		result := []interface{}{}
+		for _, e := range x {
+			result = append(result, recordValue(e))
+		}
+		return result
+	case map[coinharness.Hash]bool:
+		result := make(map[string]bool)
+		for k, e := range x {
+			result[recordValue(k).(string)] = e
+		}
+		return result
+	case coinharness.Address:
+		return x.String()
+	case []coinharness.Address:
+		result := []string{}
+		for _, e := range x {
+			result = append(result, e.String())
+		}
+		return result
+	case *coinharness.MessageTx:
+		if x == nil {
+			return nil
+		}
+		return recordBytes(TransactionTxToRaw(x).Bytes())
+	case *wire.MsgTx:
+		if x == nil {
+			return nil
+		}
+		return recordBytes(x.Bytes())
+	case *wire.MsgBlock:
+		if x == nil {
+			return nil
+		}
+		return recordBytes(x.Bytes())
+	case *dcrutil.Block:
+		return recordBytes(x.Bytes())
+	case []byte:
+		return hex.EncodeToString(x)
+	case [][]byte:
+		result := []string{}
+		for _, e := range x {
+			result = append(result, hex.EncodeToString(e))
+		}
+		return result
+	case json.Marshaler:
+		return x
+	}
+	return recordReflect(reflect.ValueOf(v))
+}
+
+// recordBytes records the serialized value, the serialization error
+// is recorded in its place
+func recordBytes(b []byte, err error) interface{} {
+	if err != nil {
+		return err.Error()
+	}
+	return hex.EncodeToString(b)
+}
+
+// recordReflect converts the value the way encoding/json lays it out,
+// so that the recording can be unmarshalled into the original type,
+// while the fields, elements and keys go through recordValue
+func recordReflect(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return recordValue(v.Elem().Interface())
+	case reflect.Struct:
+		result := make(map[string]interface{})
+		recordFields(v, result)
+		return result
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		result := make([]interface{}, v.Len())
+		for i := range result {
+			result[i] = recordValue(v.Index(i).Interface())
+		}
+		return result
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		result := make(map[string]interface{})
+		for _, k := range v.MapKeys() {
+			key := fmt.Sprint(recordValue(k.Interface()))
+			result[key] = recordValue(v.MapIndex(k).Interface())
+		}
+		return result
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return nil
+	}
+	return v.Interface()
+}
+
+// recordFields adds the exported fields of the struct to the map,
+// fields of embedded structs are promoted like encoding/json does
+func recordFields(v reflect.Value, result map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			}
+		}
+		f := v.Field(i)
+		if field.Anonymous {
+			if f.Kind() == reflect.Ptr && !f.IsNil() {
+				f = f.Elem()
+			}
+			if f.Kind() == reflect.Struct {
+				recordFields(f, result)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		result[name] = recordValue(f.Interface())
+	}
+}
+
+// bestBlockResult is the recorded form of the GetBestBlock() result
+type bestBlockResult struct {
+	Hash   string
+	Height int64
+}
+
+// RecordNotifications wraps the handlers so every notification is recorded
+// by the recorder before the handler is called, absent handlers stay absent
+func RecordNotifications(handlers *coinharness.NotificationHandlers, recorder *Recorder) *coinharness.NotificationHandlers {
+	if handlers == nil {
+		return nil
+	}
+	h := *handlers
+	if f := handlers.OnClientConnected; f != nil {
+		h.OnClientConnected = func() {
+			recorder.Notification("OnClientConnected")
+			f()
+		}
+	}
+	if f := handlers.OnBlockConnected; f != nil {
+		h.OnBlockConnected = func(blockHeader []byte, transactions [][]byte) {
+			recorder.Notification("OnBlockConnected", blockHeader, transactions)
+			f(blockHeader, transactions)
+		}
+	}
+	if f := handlers.OnBlockDisconnected; f != nil {
+		h.OnBlockDisconnected = func(blockHeader []byte) {
+			recorder.Notification("OnBlockDisconnected", blockHeader)
+			f(blockHeader)
+		}
+	}
+	if f := handlers.OnRelevantTxAccepted; f != nil {
+		h.OnRelevantTxAccepted = func(transaction []byte) {
+			recorder.Notification("OnRelevantTxAccepted", transaction)
+			f(transaction)
+		}
+	}
+	if f := handlers.OnWinningTickets; f != nil {
+		h.OnWinningTickets = func(blockHash coinharness.Hash, blockHeight int64, tickets []coinharness.Hash) {
+			recorder.Notification("OnWinningTickets", blockHash, blockHeight, tickets)
+			f(blockHash, blockHeight, tickets)
+		}
+	}
+	if f := handlers.OnSpentAndMissedTickets; f != nil {
+		h.OnSpentAndMissedTickets = func(hash coinharness.Hash, height int64, stakeDiff int64, tickets map[coinharness.Hash]bool) {
+			recorder.Notification("OnSpentAndMissedTickets", hash, height, stakeDiff, tickets)
+			f(hash, height, stakeDiff, tickets)
+		}
+	}
+	if f := handlers.OnNewTickets; f != nil {
+		h.OnNewTickets = func(hash coinharness.Hash, height int64, stakeDiff int64, tickets []coinharness.Hash) {
+			recorder.Notification("OnNewTickets", hash, height, stakeDiff, tickets)
+			f(hash, height, stakeDiff, tickets)
+		}
+	}
+	if f := handlers.OnStakeDifficulty; f != nil {
+		h.OnStakeDifficulty = func(hash coinharness.Hash, height int64, stakeDiff int64) {
+			recorder.Notification("OnStakeDifficulty", hash, height, stakeDiff)
+			f(hash, height, stakeDiff)
+		}
+	}
+	if f := handlers.OnTxAccepted; f != nil {
+		h.OnTxAccepted = func(hash coinharness.Hash, amount coin.Amount) {
+			recorder.Notification("OnTxAccepted", hash, amount)
+			f(hash, amount)
+		}
+	}
+	if f := handlers.OnNodeConnected; f != nil {
+		h.OnNodeConnected = func(connected bool) {
+			recorder.Notification("OnNodeConnected", connected)
+			f(connected)
+		}
+	}
+	if f := handlers.OnAccountBalance; f != nil {
+		h.OnAccountBalance = func(account string, balance coin.Amount, confirmed bool) {
+			recorder.Notification("OnAccountBalance", account, balance, confirmed)
+			f(account, balance, confirmed)
+		}
+	}
+	if f := handlers.OnWalletLockState; f != nil {
+		h.OnWalletLockState = func(locked bool) {
+			recorder.Notification("OnWalletLockState", locked)
+			f(locked)
+		}
+	}
+	if f := handlers.OnTicketsPurchased; f != nil {
+		h.OnTicketsPurchased = func(txHash coinharness.Hash, amount coin.Amount) {
+			recorder.Notification("OnTicketsPurchased", txHash, amount)
+			f(txHash, amount)
+		}
+	}
+	if f := handlers.OnVotesCreated; f != nil {
+		h.OnVotesCreated = func(txHash coinharness.Hash, blockHash coinharness.Hash, height int32, sstxIn coinharness.Hash, voteBits uint16) {
+			recorder.Notification("OnVotesCreated", txHash, blockHash, height, sstxIn, voteBits)
+			f(txHash, blockHash, height, sstxIn, voteBits)
+		}
+	}
+	if f := handlers.OnRevocationsCreated; f != nil {
+		h.OnRevocationsCreated = func(txHash coinharness.Hash, sstxIn coinharness.Hash) {
+			recorder.Notification("OnRevocationsCreated", txHash, sstxIn)
+			f(txHash, sstxIn)
+		}
+	}
+	if f := handlers.OnUnknownNotification; f != nil {
+		h.OnUnknownNotification = func(method string, params []json.RawMessage) {
+			recorder.Notification("OnUnknownNotification", method, params)
+			f(method, params)
+		}
+	}
+	return &h
+}
@@ -0,0 +1,226 @@
+package dcrharness
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/rpcclient"
+	"github.com/decred/dcrd/wire"
+	"github.com/jfixby/coin"
+	"github.com/jfixby/coinharness"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcrharness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "session.jsonl")
+
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &RPCClient{}
+	c.SetRecorder(recorder.ForClient("a"))
+	other := &RPCClient{}
+	other.SetRecorder(recorder.ForClient("b"))
+
+	// the client wrappers defer the same calls
+	respond := func(method string, result interface{}, err error) {
+		c.record(method)(result, &err)
+	}
+	bestHash := chainhash.HashH([]byte("best"))
+	generated := []coinharness.Hash{
+		heightHash(1),
+		heightHash(2),
+	}
+	block := wire.NewMsgBlock(&wire.BlockHeader{
+		PrevBlock: bestHash,
+		Height:    43,
+		Timestamp: time.Unix(1454954400, 0),
+	})
+	coinbase := wire.NewMsgTx()
+	coinbase.AddTxOut(wire.NewTxOut(1000, []byte{0x51}))
+	if err := block.AddTransaction(coinbase); err != nil {
+		t.Fatal(err)
+	}
+	accounts := map[string]coin.Amount{"default": {1000}}
+
+	count := int64(42)
+	otherCount := int64(7)
+	other.record("getblockcount")(&otherCount, nil)
+	respond("getblockcount", &count, nil)
+	respond("getbestblock", &bestBlockResult{Hash: bestHash.String(), Height: count}, nil)
+	respond("generate", &generated, nil)
+	respond("getblock", &block, nil)
+	respond("listaccounts", &accounts, nil)
+	respond("sendrawtransaction", nil, errors.New("rejected"))
+	recorder.Notification("OnBlockConnected", bestHash)
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := NewReplayRPCClient(path, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotCount, err := replay.GetBlockCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotCount != count {
+		t.Errorf("got block count %v of another client, want %v",
+			gotCount, count)
+	}
+	if gotCount, err := replay.GetBlockCount(); err == nil {
+		t.Errorf("replayed block count %v past the recording", gotCount)
+	}
+
+	gotHash, gotHeight, err := replay.GetBestBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gotHash.(*chainhash.Hash).IsEqual(&bestHash) || gotHeight != count {
+		t.Errorf("got best block %v at %v, want %v at %v", gotHash,
+			gotHeight, bestHash, count)
+	}
+
+	gotGenerated, err := replay.Generate(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gotGenerated) != len(generated) {
+		t.Fatalf("got %v generated blocks, want %v", len(gotGenerated),
+			len(generated))
+	}
+	for i, hash := range gotGenerated {
+		if !hash.(*chainhash.Hash).IsEqual(generated[i].(*chainhash.Hash)) {
+			t.Errorf("got generated block %v, want %v", hash,
+				generated[i])
+		}
+	}
+
+	gotBlock, err := GetFullBlock(replay, &bestHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockHash := block.BlockHash()
+	if !gotBlock.BlockHash.(*chainhash.Hash).IsEqual(&blockHash) {
+		t.Errorf("got block %v, want %v", gotBlock.BlockHash, blockHash)
+	}
+	if gotBlock.Header.Height != int64(block.Header.Height) ||
+		!gotBlock.Header.PrevBlock.(*chainhash.Hash).IsEqual(&bestHash) {
+		t.Errorf("got block header %+v, want %+v", gotBlock.Header,
+			block.Header)
+	}
+
+	gotAccounts, err := replay.ListAccounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotAccounts["default"] != accounts["default"] {
+		t.Errorf("got accounts %v, want %v", gotAccounts, accounts)
+	}
+
+	_, err = replay.SendRawTransaction(TransactionRawToTx(coinbase), false)
+	if err == nil || err.Error() != "rejected" {
+		t.Errorf("got error %v, want the recorded one", err)
+	}
+
+	if _, ok := replay.Internal().(error); !ok {
+		t.Errorf("replay client exposes an internal connection")
+	}
+}
+
+// rpcServer answers the JSON-RPC requests with the canned results
+// of their methods
+func rpcServer(results map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"result":%v,"error":null,"id":%s}`,
+			results[request.Method], request.ID)
+	}))
+}
+
+func TestRecordWrappers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcrharness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "session.jsonl")
+
+	bestHash := chainhash.HashH([]byte("best"))
+	server := rpcServer(map[string]string{
+		"getbestblock":  fmt.Sprintf(`{"hash":"%v","height":42}`, bestHash),
+		"getblockcount": "42",
+	})
+	defer server.Close()
+
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := strings.TrimPrefix(server.URL, "http://")
+	c, err := newRPCClient(&rpcclient.ConnConfig{
+		Host:         host,
+		HTTPPostMode: true,
+		DisableTLS:   true,
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetRecorder(recorder.ForClient(host))
+
+	hash, height, err := c.GetBestBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := c.GetBlockCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Shutdown()
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := NewReplayRPCClient(path, host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotHash, gotHeight, err := replay.GetBestBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gotHash.(*chainhash.Hash).IsEqual(hash.(*chainhash.Hash)) ||
+		gotHeight != height {
+		t.Errorf("got best block %v at %v, want %v at %v", gotHash,
+			gotHeight, hash, height)
+	}
+	gotCount, err := replay.GetBlockCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotCount != count {
+		t.Errorf("got block count %v, want %v", gotCount, count)
+	}
+}
@@ -0,0 +1,267 @@
+package dcrharness
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/wire"
+	"github.com/jfixby/coin"
+	"github.com/jfixby/coinharness"
+	"os"
+	"sync"
+)
+
+// ReplayRPCClient serves the responses of a recording made by the Recorder
+// so a failing session can be reproduced without a node. Every call returns
+// the next recorded response of the same method made by the replayed client.
+type ReplayRPCClient struct {
+	mtx       sync.Mutex
+	responses map[string][]*RecordEntry
+}
+
+// NewReplayRPCClient loads the entries of the given client from the
+// recording file. The client is the host of the node for the recordings
+// made through RPCClientFactory, empty for the untagged Recorder.
+func NewReplayRPCClient(path string, client string) (*ReplayRPCClient, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	c := &ReplayRPCClient{
+		responses: make(map[string][]*RecordEntry),
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, wire.MaxMessagePayload)
+	for scanner.Scan() {
+		entry := &RecordEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, err
+		}
+		if entry.Client != client {
+			continue
+		}
+		if entry.Kind != RecordResponse && entry.Kind != RecordError {
+			continue
+		}
+		c.responses[entry.Method] = append(c.responses[entry.Method], entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// next pops the next recorded response of the method and unmarshals
+// its result into the passed value unless it is nil
+func (c *ReplayRPCClient) next(method string, result interface{}) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	list := c.responses[method]
+	if len(list) == 0 {
+		return fmt.Errorf("no recorded response left for %v", method)
+	}
+	entry := list[0]
+	c.responses[method] = list[1:]
+	if entry.Kind == RecordError {
+		return errors.New(entry.Error)
+	}
+	if result == nil || len(entry.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(entry.Result, result)
+}
+
+// ErrReplayInternal is returned by ReplayRPCClient.Internal(), there is
+// no connection behind the replay client
+var ErrReplayInternal = errors.New("replay client has no internal connection")
+
+// Internal returns ErrReplayInternal, helpers asserting the internal
+// connection type fail instead of receiving nil
+func (c *ReplayRPCClient) Internal() interface{} {
+	return ErrReplayInternal
+}
+
+func (c *ReplayRPCClient) Disconnect() {
+	c.next("disconnect", nil)
+}
+
+func (c *ReplayRPCClient) Shutdown() {
+	c.next("shutdown", nil)
+}
+
+func (c *ReplayRPCClient) NotifyBlocks() error {
+	return c.next("notifyblocks", nil)
+}
+
+func (c *ReplayRPCClient) GetBlockCount() (int64, error) {
+	var result int64
+	err := c.next("getblockcount", &result)
+	return result, err
+}
+
+func (c *ReplayRPCClient) Generate(blocks uint32) ([]coinharness.Hash, error) {
+	return c.nextHashes("generate")
+}
+
+func (c *ReplayRPCClient) GetRawMempool(command interface{}) ([]coinharness.Hash, error) {
+	return c.nextHashes("getrawmempool")
+}
+
+func (c *ReplayRPCClient) SendRawTransaction(tx *coinharness.MessageTx, allowHighFees bool) (coinharness.Hash, error) {
+	var result string
+	if err := c.next("sendrawtransaction", &result); err != nil {
+		return nil, err
+	}
+	return chainhash.NewHashFromStr(result)
+}
+
+func (c *ReplayRPCClient) GetPeerInfo() ([]coinharness.PeerInfo, error) {
+	result := []coinharness.PeerInfo{}
+	if err := c.next("getpeerinfo", &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *ReplayRPCClient) SubmitBlock(block coinharness.Block) error {
+	return c.next("submitblock", nil)
+}
+
+func (c *ReplayRPCClient) LoadTxFilter(reload bool, addr []coinharness.Address) error {
+	return c.next("loadtxfilter", nil)
+}
+
+func (c *ReplayRPCClient) AddNode(args *coinharness.AddNodeArguments) error {
+	return c.next("addnode", nil)
+}
+
+func (c *ReplayRPCClient) ListUnspent() ([]*coinharness.Unspent, error) {
+	result := []*coinharness.Unspent{}
+	if err := c.next("listunspent", &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *ReplayRPCClient) GetBlock(hash coinharness.Hash) (*coinharness.MsgBlock, error) {
+	block, err := c.GetMsgBlock(hash)
+	if err != nil {
+		return nil, err
+	}
+	return block.HarnessBlock(), nil
+}
+
+// GetMsgBlock replays RPCClient.GetMsgBlock()
+func (c *ReplayRPCClient) GetMsgBlock(hash coinharness.Hash) (*MsgBlock, error) {
+	var blockHex string
+	if err := c.next("getblock", &blockHex); err != nil {
+		return nil, err
+	}
+	blockBytes, err := hex.DecodeString(blockHex)
+	if err != nil {
+		return nil, err
+	}
+	block := &wire.MsgBlock{}
+	if err := block.FromBytes(blockBytes); err != nil {
+		return nil, err
+	}
+	return BlockRawToMsgBlock(block), nil
+}
+
+func (c *ReplayRPCClient) GetNewAddress(account string) (coinharness.Address, error) {
+	var result string
+	if err := c.next("getnewaddress", &result); err != nil {
+		return nil, err
+	}
+	legacy, err := dcrutil.DecodeAddress(result)
+	if err != nil {
+		return nil, err
+	}
+	return &Address{Address: legacy}, nil
+}
+
+func (c *ReplayRPCClient) ValidateAddress(address coinharness.Address) (*coinharness.ValidateAddressResult, error) {
+	result := &coinharness.ValidateAddressResult{}
+	if err := c.next("validateaddress", result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *ReplayRPCClient) GetBalance() (*coinharness.GetBalanceResult, error) {
+	result := &coinharness.GetBalanceResult{}
+	if err := c.next("getbalance", result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *ReplayRPCClient) GetBestBlock() (coinharness.Hash, int64, error) {
+	result := &bestBlockResult{}
+	if err := c.next("getbestblock", result); err != nil {
+		return nil, 0, err
+	}
+	hash, err := chainhash.NewHashFromStr(result.Hash)
+	if err != nil {
+		return nil, 0, err
+	}
+	return hash, result.Height, nil
+}
+
+func (c *ReplayRPCClient) ListAccounts() (map[string]coin.Amount, error) {
+	result := make(map[string]coin.Amount)
+	if err := c.next("listaccounts", &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *ReplayRPCClient) CreateNewAccount(account string) error {
+	return c.next("createnewaccount", nil)
+}
+
+func (c *ReplayRPCClient) WalletLock() error {
+	return c.next("walletlock", nil)
+}
+
+func (c *ReplayRPCClient) WalletInfo() (*coinharness.WalletInfoResult, error) {
+	result := &coinharness.WalletInfoResult{}
+	if err := c.next("walletinfo", result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *ReplayRPCClient) WalletUnlock(passphrase string, timeoutSecs int64) error {
+	return c.next("walletpassphrase", nil)
+}
+
+func (c *ReplayRPCClient) GetBuildVersion() (coinharness.BuildVersion, error) {
+	result := &BuildVersion{}
+	if err := c.next("version", result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *ReplayRPCClient) nextHashes(method string) ([]coinharness.Hash, error) {
+	recorded := []string{}
+	if err := c.next(method, &recorded); err != nil {
+		return nil, err
+	}
+	result := []coinharness.Hash{}
+	for _, e := range recorded {
+		hash, err := chainhash.NewHashFromStr(e)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, hash)
+	}
+	return result, nil
+}
@@ -0,0 +1,293 @@
+package dcrharness
+
+import (
+	"encoding/hex"
+	"github.com/decred/dcrd/blockchain"
+	"github.com/decred/dcrd/blockchain/stake"
+	"github.com/decred/dcrd/chaincfg"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/txscript"
+	"github.com/decred/dcrd/wire"
+	"github.com/jfixby/coin"
+	"github.com/jfixby/coinharness"
+)
+
+// rescanBatchSize is the number of blocks requested by a single
+// rescan command
+const rescanBatchSize = 500
+
+// DefaultBootstrapGapLimit is the number of HD addresses past the wallet
+// HdIndex BootstrapWallet looks for
+const DefaultBootstrapGapLimit = 20
+
+// RescannedBlock is the harness representation of dcrjson.RescannedBlock,
+// Transactions are the ones matching the loaded tx filter
+type RescannedBlock struct {
+	BlockHash    coinharness.Hash
+	Height       int64
+	Transactions []*coinharness.MessageTx
+}
+
+// LoadTxFilterOutPoints loads the tx filter matching both the addresses
+// and the outpoints
+func (c *RPCClient) LoadTxFilterOutPoints(reload bool, addr []coinharness.Address, outPoints []coinharness.OutPoint) (err error) {
+	defer c.record("loadtxfilter", reload, addr, outPoints)(nil, &err)
+	addresses := []dcrutil.Address{}
+	for _, e := range addr {
+		addresses = append(addresses, e.Internal().(dcrutil.Address))
+	}
+	ops := []wire.OutPoint{}
+	for _, e := range outPoints {
+		ops = append(ops, wire.OutPoint{
+			Hash:  e.Hash.(chainhash.Hash),
+			Index: e.Index,
+			Tree:  e.Tree,
+		})
+	}
+	return c.rpc.LoadTxFilter(reload, addresses, ops)
+}
+
+// RescanBlocks rescans the blocks against the tx filter loaded by
+// LoadTxFilter and returns the blocks with matching transactions.
+// Height of the returned blocks is left zero.
+func (c *RPCClient) RescanBlocks(blockHashes []coinharness.Hash) (result []*RescannedBlock, err error) {
+	defer c.record("rescan", blockHashes)(&result, &err)
+	hashes := []chainhash.Hash{}
+	for _, e := range blockHashes {
+		hashes = append(hashes, *e.(*chainhash.Hash))
+	}
+	r, err := c.rpc.Rescan(hashes)
+	if err != nil {
+		return nil, err
+	}
+	result = []*RescannedBlock{}
+	for _, b := range r.DiscoveredData {
+		hash, err := chainhash.NewHashFromStr(b.Hash)
+		if err != nil {
+			return nil, err
+		}
+		block := &RescannedBlock{BlockHash: hash}
+		for _, txHex := range b.Transactions {
+			txBytes, err := hex.DecodeString(txHex)
+			if err != nil {
+				return nil, err
+			}
+			tx := &wire.MsgTx{}
+			if err := tx.FromBytes(txBytes); err != nil {
+				return nil, err
+			}
+			block.Transactions = append(block.Transactions, TransactionRawToTx(tx))
+		}
+		result = append(result, block)
+	}
+	return result, nil
+}
+
+// Rescan rescans the main chain blocks from the given height up to
+// and including the end height against the tx filter loaded by LoadTxFilter
+func (c *RPCClient) Rescan(startHeight, endHeight int64) ([]*RescannedBlock, error) {
+	return rescanHeights(c, startHeight, endHeight)
+}
+
+// rescanner is the part of RPCClient rescanHeights runs on
+type rescanner interface {
+	GetBlockHash(height int64) (coinharness.Hash, error)
+	RescanBlocks(blockHashes []coinharness.Hash) ([]*RescannedBlock, error)
+}
+
+// rescanHeights rescans the blocks in batches of rescanBatchSize
+// and sets the heights of the returned blocks
+func rescanHeights(rpc rescanner, startHeight, endHeight int64) ([]*RescannedBlock, error) {
+	result := []*RescannedBlock{}
+	for from := startHeight; from <= endHeight; from += rescanBatchSize {
+		to := from + rescanBatchSize - 1
+		if to > endHeight {
+			to = endHeight
+		}
+		hashes := []coinharness.Hash{}
+		heights := make(map[chainhash.Hash]int64)
+		for height := from; height <= to; height++ {
+			hash, err := rpc.GetBlockHash(height)
+			if err != nil {
+				return nil, err
+			}
+			hashes = append(hashes, hash)
+			heights[*hash.(*chainhash.Hash)] = height
+		}
+		blocks, err := rpc.RescanBlocks(hashes)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range blocks {
+			b.Height = heights[*b.BlockHash.(*chainhash.Hash)]
+		}
+		result = append(result, blocks...)
+	}
+	return result, nil
+}
+
+// BootstrapWallet rebuilds the Utxos and the ReorgJournal of the wallet
+// created against a node that already has history. It rescans the chain
+// from genesis for the wallet HD addresses and moves HdIndex past the last
+// used one. The addresses are discovered until gapLimit consecutive ones
+// past HdIndex and past the last used one are found unused.
+// The wallet must not be syncing while it is bootstrapped.
+func BootstrapWallet(wallet *coinharness.InMemoryWallet, client coinharness.RPCClient, gapLimit uint32) error {
+	net := wallet.Net.Params().(*chaincfg.Params)
+	c, err := harnessClient(client)
+	if err != nil {
+		return err
+	}
+	_, bestHeight, err := c.GetBestBlock()
+	if err != nil {
+		return err
+	}
+	derive := func(index uint32) (dcrutil.Address, error) {
+		key, err := WalletPrivateKey(wallet, index)
+		if err != nil {
+			return nil, err
+		}
+		return keyToAddr(key, net)
+	}
+	addrs, err := discoverUtxos(wallet, c, bestHeight, gapLimit, derive, net)
+	if err != nil {
+		return err
+	}
+	for index, addr := range addrs {
+		if index < wallet.HdIndex {
+			wallet.Addrs[index] = addr
+		}
+	}
+	return nil
+}
+
+// walletRescanner is the part of RPCClient discoverUtxos runs on
+type walletRescanner interface {
+	LoadTxFilter(reload bool, addr []coinharness.Address) error
+	Rescan(startHeight, endHeight int64) ([]*RescannedBlock, error)
+}
+
+// discoverUtxos rescans the chain up to bestHeight for the addresses
+// returned by derive, deriving gapLimit more and rescanning again until
+// the gap past the last used address and past HdIndex is covered. It
+// rebuilds the wallet Utxos and ReorgJournal, moves HdIndex past the last
+// used address and returns the derived addresses by their index.
+func discoverUtxos(wallet *coinharness.InMemoryWallet, rpc walletRescanner, bestHeight int64, gapLimit uint32, derive func(index uint32) (dcrutil.Address, error), net *chaincfg.Params) (map[uint32]coinharness.Address, error) {
+	addrs := make(map[uint32]coinharness.Address)
+	indexes := make(map[string]uint32)
+	filter := []coinharness.Address{}
+	scanned := uint32(0)
+	lastUsed := int64(-1)
+	for rescanned := false; ; rescanned = true {
+		target := wallet.HdIndex
+		if uint32(lastUsed+1) > target {
+			target = uint32(lastUsed + 1)
+		}
+		target += gapLimit
+		if rescanned && scanned >= target {
+			break
+		}
+
+		for index := scanned; index < target; index++ {
+			addr, err := derive(index)
+			if err != nil {
+				return nil, err
+			}
+			a := &Address{Address: addr}
+			addrs[index] = a
+			indexes[addr.EncodeAddress()] = index
+			filter = append(filter, a)
+		}
+		scanned = target
+
+		// The whole chain is rescanned so that outputs paid to the new
+		// addresses and spent later are tracked as spent.
+		if err := rpc.LoadTxFilter(true, filter); err != nil {
+			return nil, err
+		}
+		blocks, err := rpc.Rescan(1, bestHeight)
+		if err != nil {
+			return nil, err
+		}
+		lastUsed = rebuildUtxos(wallet, blocks, bestHeight, indexes, net)
+	}
+
+	if uint32(lastUsed+1) > wallet.HdIndex {
+		wallet.HdIndex = uint32(lastUsed + 1)
+	}
+	return addrs, nil
+}
+
+// rebuildUtxos replaces the Utxos and the ReorgJournal of the wallet with
+// the ones found in the rescanned blocks up to bestHeight. The indexes map
+// the encoded wallet addresses to their HD indexes, the highest index
+// receiving an output is returned, -1 when there is none.
+func rebuildUtxos(wallet *coinharness.InMemoryWallet, blocks []*RescannedBlock, bestHeight int64, indexes map[string]uint32, net *chaincfg.Params) int64 {
+	byHeight := make(map[int64]*RescannedBlock)
+	for _, b := range blocks {
+		byHeight[b.Height] = b
+	}
+
+	wallet.Utxos = make(map[coinharness.OutPoint]*coinharness.Utxo)
+	wallet.ReorgJournal = make(map[int64]*coinharness.UndoEntry)
+	lastUsed := int64(-1)
+	for height := int64(1); height <= bestHeight; height++ {
+		// every height gets an undo entry so the wallet
+		// is able to unwind any block
+		undo := &coinharness.UndoEntry{
+			UtxosDestroyed: make(map[coinharness.OutPoint]*coinharness.Utxo),
+		}
+		wallet.ReorgJournal[height] = undo
+		b, ok := byHeight[height]
+		if !ok {
+			continue
+		}
+		for _, tx := range b.Transactions {
+			for _, in := range tx.TxIn {
+				op := in.PreviousOutPoint
+				if utxo, ok := wallet.Utxos[op]; ok {
+					undo.UtxosDestroyed[op] = utxo
+					delete(wallet.Utxos, op)
+				}
+			}
+
+			rawTx := TransactionTxToRaw(tx)
+			tree := wire.TxTreeRegular
+			if stake.DetermineTxType(rawTx) != stake.TxTypeRegular {
+				tree = wire.TxTreeStake
+			}
+			maturityHeight := height
+			if blockchain.IsCoinBaseTx(rawTx) {
+				maturityHeight += int64(net.CoinbaseMaturity)
+			}
+			for i, out := range rawTx.TxOut {
+				class, outAddrs, _, err := txscript.ExtractPkScriptAddrs(
+					out.Version, out.PkScript, net)
+				if err != nil || class != txscript.PubKeyHashTy {
+					continue
+				}
+				index, ok := indexes[outAddrs[0].EncodeAddress()]
+				if !ok {
+					continue
+				}
+				op := coinharness.OutPoint{
+					Hash:  tx.TxHash(),
+					Index: uint32(i),
+					Tree:  tree,
+				}
+				wallet.Utxos[op] = &coinharness.Utxo{
+					Value:          coin.Amount{out.Value},
+					KeyIndex:       index,
+					MaturityHeight: maturityHeight,
+					PkScript:       out.PkScript,
+				}
+				undo.UtxosCreated = append(undo.UtxosCreated, op)
+				if int64(index) > lastUsed {
+					lastUsed = int64(index)
+				}
+			}
+		}
+	}
+	return lastUsed
+}
@@ -0,0 +1,279 @@
+package dcrharness
+
+import (
+	"encoding/binary"
+	"github.com/decred/dcrd/chaincfg"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrec/secp256k1"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/txscript"
+	"github.com/decred/dcrd/wire"
+	"github.com/jfixby/coinharness"
+	"testing"
+)
+
+// heightHash returns the fake hash of the block at the given height
+func heightHash(height int64) *chainhash.Hash {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(height))
+	hash := chainhash.HashH(b[:])
+	return &hash
+}
+
+// fakeRescanner reports every requested block as matching
+// and keeps the sizes of the rescan batches
+type fakeRescanner struct {
+	batches []int
+}
+
+func (r *fakeRescanner) GetBlockHash(height int64) (coinharness.Hash, error) {
+	return heightHash(height), nil
+}
+
+func (r *fakeRescanner) RescanBlocks(blockHashes []coinharness.Hash) ([]*RescannedBlock, error) {
+	r.batches = append(r.batches, len(blockHashes))
+	result := []*RescannedBlock{}
+	for _, hash := range blockHashes {
+		h := *hash.(*chainhash.Hash)
+		result = append(result, &RescannedBlock{BlockHash: &h})
+	}
+	return result, nil
+}
+
+func TestRescanHeights(t *testing.T) {
+	tests := []struct {
+		start, end int64
+		batches    []int
+	}{
+		{start: 5, end: 4, batches: nil},
+		{start: 1, end: 1, batches: []int{1}},
+		{start: 1, end: rescanBatchSize, batches: []int{rescanBatchSize}},
+		{start: 1, end: rescanBatchSize + 1, batches: []int{rescanBatchSize, 1}},
+		{
+			start:   0,
+			end:     rescanBatchSize*2 + 200,
+			batches: []int{rescanBatchSize, rescanBatchSize, 201},
+		},
+	}
+
+	for _, test := range tests {
+		rpc := &fakeRescanner{}
+		blocks, err := rescanHeights(rpc, test.start, test.end)
+		if err != nil {
+			t.Errorf("%v-%v: unexpected error: %v", test.start, test.end, err)
+			continue
+		}
+		if len(rpc.batches) != len(test.batches) {
+			t.Errorf("%v-%v: got batches %v, want %v", test.start,
+				test.end, rpc.batches, test.batches)
+			continue
+		}
+		for i := range test.batches {
+			if rpc.batches[i] != test.batches[i] {
+				t.Errorf("%v-%v: got batches %v, want %v", test.start,
+					test.end, rpc.batches, test.batches)
+				break
+			}
+		}
+		for i, b := range blocks {
+			height := test.start + int64(i)
+			if b.Height != height || !heightHash(height).IsEqual(b.BlockHash.(*chainhash.Hash)) {
+				t.Errorf("%v-%v: block %v got height %v, want %v",
+					test.start, test.end, i, b.Height, height)
+			}
+		}
+	}
+}
+
+func TestRebuildUtxos(t *testing.T) {
+	net := &chaincfg.SimNetParams
+	scripts := make([][]byte, 3)
+	indexes := make(map[string]uint32)
+	for i := range scripts {
+		key, err := secp256k1.GeneratePrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr, err := keyToAddr(key, net)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scripts[i], err = txscript.PayToAddrScript(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// index 1 is not a wallet address
+		if i != 1 {
+			indexes[addr.EncodeAddress()] = uint32(i)
+		}
+	}
+
+	coinbase := wire.NewMsgTx()
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex, wire.TxTreeRegular),
+		Sequence: wire.MaxTxInSequenceNum,
+	})
+	coinbase.AddTxOut(wire.NewTxOut(50*dcrutil.AtomsPerCoin, scripts[0]))
+	coinbaseHash := coinbase.TxHash()
+
+	spend := wire.NewMsgTx()
+	spend.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&coinbaseHash, 0,
+			wire.TxTreeRegular),
+		Sequence: wire.MaxTxInSequenceNum,
+		ValueIn:  50 * dcrutil.AtomsPerCoin,
+	})
+	spend.AddTxOut(wire.NewTxOut(30*dcrutil.AtomsPerCoin, scripts[2]))
+	spend.AddTxOut(wire.NewTxOut(19*dcrutil.AtomsPerCoin, scripts[1]))
+	spendHash := spend.TxHash()
+
+	blocks := []*RescannedBlock{
+		{Height: 1, Transactions: []*coinharness.MessageTx{TransactionRawToTx(coinbase)}},
+		{Height: 3, Transactions: []*coinharness.MessageTx{TransactionRawToTx(spend)}},
+		// past the best height
+		{Height: 6, Transactions: []*coinharness.MessageTx{TransactionRawToTx(coinbase)}},
+	}
+	const bestHeight = 4
+	wallet := &coinharness.InMemoryWallet{}
+	lastUsed := rebuildUtxos(wallet, blocks, bestHeight, indexes, net)
+
+	if lastUsed != 2 {
+		t.Errorf("got last used index %v, want 2", lastUsed)
+	}
+	if len(wallet.ReorgJournal) != bestHeight {
+		t.Errorf("got %v undo entries, want %v", len(wallet.ReorgJournal),
+			bestHeight)
+	}
+
+	coinbaseOp := coinharness.OutPoint{Hash: coinbaseHash, Index: 0, Tree: wire.TxTreeRegular}
+	spendOp := coinharness.OutPoint{Hash: spendHash, Index: 0, Tree: wire.TxTreeRegular}
+	if len(wallet.Utxos) != 1 {
+		t.Fatalf("got %v utxos, want 1", len(wallet.Utxos))
+	}
+	utxo, ok := wallet.Utxos[spendOp]
+	if !ok {
+		t.Fatalf("missing utxo %v", spendOp)
+	}
+	if utxo.KeyIndex != 2 || utxo.MaturityHeight != 3 ||
+		utxo.Value.ToAtoms() != 30*dcrutil.AtomsPerCoin {
+		t.Errorf("unexpected utxo %+v", utxo)
+	}
+
+	created := wallet.ReorgJournal[1].UtxosCreated
+	if len(created) != 1 || created[0] != coinbaseOp {
+		t.Errorf("got created utxos %v at height 1, want %v", created,
+			coinbaseOp)
+	}
+	destroyed, ok := wallet.ReorgJournal[3].UtxosDestroyed[coinbaseOp]
+	if !ok {
+		t.Fatalf("coinbase utxo is not destroyed at height 3")
+	}
+	maturity := 1 + int64(net.CoinbaseMaturity)
+	if destroyed.MaturityHeight != maturity {
+		t.Errorf("got coinbase maturity height %v, want %v",
+			destroyed.MaturityHeight, maturity)
+	}
+}
+
+// fakeWalletRescanner reports the blocks paying the loaded addresses,
+// block h pays the address used[h-1]
+type fakeWalletRescanner struct {
+	used   []dcrutil.Address
+	loaded map[string]bool
+	rounds int
+}
+
+func (r *fakeWalletRescanner) LoadTxFilter(reload bool, addr []coinharness.Address) error {
+	r.loaded = make(map[string]bool)
+	for _, a := range addr {
+		r.loaded[a.String()] = true
+	}
+	return nil
+}
+
+func (r *fakeWalletRescanner) Rescan(startHeight, endHeight int64) ([]*RescannedBlock, error) {
+	r.rounds++
+	result := []*RescannedBlock{}
+	for height := startHeight; height <= endHeight; height++ {
+		addr := r.used[height-1]
+		if !r.loaded[addr.String()] {
+			continue
+		}
+		script, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			return nil, err
+		}
+		tx := wire.NewMsgTx()
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: *wire.NewOutPoint(heightHash(height), 0,
+				wire.TxTreeRegular),
+			Sequence: wire.MaxTxInSequenceNum,
+		})
+		tx.AddTxOut(wire.NewTxOut(dcrutil.AtomsPerCoin, script))
+		result = append(result, &RescannedBlock{
+			Height:       height,
+			Transactions: []*coinharness.MessageTx{TransactionRawToTx(tx)},
+		})
+	}
+	return result, nil
+}
+
+func TestDiscoverUtxos(t *testing.T) {
+	net := &chaincfg.SimNetParams
+	const gapLimit = 20
+	hd := make([]dcrutil.Address, 0, 65)
+	for i := 0; i < cap(hd); i++ {
+		key, err := secp256k1.GeneratePrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr, err := keyToAddr(key, net)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hd = append(hd, addr)
+	}
+	derive := func(index uint32) (dcrutil.Address, error) {
+		return hd[index], nil
+	}
+
+	tests := []struct {
+		name    string
+		used    int
+		rounds  int
+		hdIndex uint32
+		derived int
+	}{
+		{name: "unused wallet", used: 0, rounds: 1, hdIndex: 0, derived: 20},
+		{name: "within the gap", used: 6, rounds: 2, hdIndex: 6, derived: 26},
+		{name: "past the gap", used: 45, rounds: 4, hdIndex: 45, derived: 65},
+	}
+
+	for _, test := range tests {
+		rpc := &fakeWalletRescanner{used: hd[:test.used]}
+		wallet := &coinharness.InMemoryWallet{}
+		addrs, err := discoverUtxos(wallet, rpc, int64(test.used),
+			gapLimit, derive, net)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.name, err)
+			continue
+		}
+		if rpc.rounds != test.rounds {
+			t.Errorf("%v: got %v rescans, want %v", test.name,
+				rpc.rounds, test.rounds)
+		}
+		if wallet.HdIndex != test.hdIndex {
+			t.Errorf("%v: got HdIndex %v, want %v", test.name,
+				wallet.HdIndex, test.hdIndex)
+		}
+		if len(addrs) != test.derived {
+			t.Errorf("%v: got %v derived addresses, want %v", test.name,
+				len(addrs), test.derived)
+		}
+		if len(wallet.Utxos) != test.used {
+			t.Errorf("%v: got %v utxos, want %v", test.name,
+				len(wallet.Utxos), test.used)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package dcrharness
+
+import (
+	"fmt"
+	"github.com/decred/dcrd/blockchain/stake"
+	"github.com/decred/dcrd/chaincfg"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/txscript"
+	"github.com/decred/dcrd/wire"
+	"github.com/jfixby/coinharness"
+	"sync"
+)
+
+// DefaultRevocationFeeRate is the fee rate per kB paid by revocations
+// when none is specified
+const DefaultRevocationFeeRate dcrutil.Amount = 1e4
+
+// RevocationArgs describes how NewRevocation() signs and funds revocations
+type RevocationArgs struct {
+	// Keys hold the voting keys of the harness
+	Keys *KeyStore
+	// FeeRate is the fee per kB paid by the revocation,
+	// zero stands for DefaultRevocationFeeRate
+	FeeRate dcrutil.Amount
+	Network *chaincfg.Params
+}
+
+// NewRevocation creates a signed SSRtx revoking the missed or expired ticket.
+// The ticket price is refunded to the commitment addresses of the ticket
+// proportionally to their contributions, the fee is paid by the first refund.
+// The revocation can be broadcast by SendRevocation or passed to CreateBlock
+// as a part of the stake tree.
+func NewRevocation(ticket *wire.MsgTx, args *RevocationArgs) (*dcrutil.Tx, error) {
+	net := args.Network
+	feeRate := args.FeeRate
+	if feeRate == 0 {
+		feeRate = DefaultRevocationFeeRate
+	}
+	ticketPrice := ticket.TxOut[0].Value
+
+	tx := wire.NewMsgTx()
+	ticketHash := ticket.TxHash()
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&ticketHash, 0,
+			wire.TxTreeStake),
+		Sequence:    wire.MaxTxInSequenceNum,
+		ValueIn:     ticketPrice,
+		BlockHeight: wire.NullBlockHeight,
+		BlockIndex:  wire.NullBlockIndex,
+	})
+
+	commitments, err := ticketCommitments(ticket, net)
+	if err != nil {
+		return nil, err
+	}
+	amounts := make([]int64, len(commitments))
+	for i, c := range commitments {
+		amounts[i] = c.amount
+	}
+	refunds := stake.CalculateRewards(amounts, ticketPrice, 0)
+	for i, c := range commitments {
+		pkScript, err := txscript.PayToSSRtx(c.addr)
+		if err != nil {
+			return nil, err
+		}
+		tx.AddTxOut(wire.NewTxOut(refunds[i], pkScript))
+	}
+
+	// Sign once to learn the size of the revocation, then reduce
+	// the first refund by the fee and sign again.
+	if err := signTicketInput(tx, 0, ticket, args.Keys, net); err != nil {
+		return nil, err
+	}
+	fee := int64(feeRate) * int64(tx.SerializeSize()) / 1000
+	if fee >= tx.TxOut[0].Value {
+		return nil, fmt.Errorf("revocation fee %v exceeds the refund %v",
+			dcrutil.Amount(fee), dcrutil.Amount(tx.TxOut[0].Value))
+	}
+	tx.TxOut[0].Value -= fee
+	if isDust(tx.TxOut[0], feeRate) {
+		return nil, fmt.Errorf("refund %v left after the fee %v is dust",
+			dcrutil.Amount(tx.TxOut[0].Value), dcrutil.Amount(fee))
+	}
+	if err := signTicketInput(tx, 0, ticket, args.Keys, net); err != nil {
+		return nil, err
+	}
+
+	revocation := dcrutil.NewTx(tx)
+	revocation.SetTree(wire.TxTreeStake)
+	return revocation, nil
+}
+
+// isDust mirrors the dcrd mempool policy: an output is dust when spending
+// it costs more than a third of its value at the relay fee rate. The 165
+// bytes are the size of the input redeeming a pay-to-pubkey-hash output.
+func isDust(txOut *wire.TxOut, relayFeeRate dcrutil.Amount) bool {
+	totalSize := txOut.SerializeSize() + 165
+	return txOut.Value*1000/(3*int64(totalSize)) < int64(relayFeeRate)
+}
+
+// NewRevocations creates revocations for every missed or expired ticket
+// known to the node and controlled by the harness keys
+func NewRevocations(client coinharness.RPCClient, args *RevocationArgs) ([]*dcrutil.Tx, error) {
+	c, err := harnessClient(client)
+	if err != nil {
+		return nil, err
+	}
+	missed, err := c.MissedTickets()
+	if err != nil {
+		return nil, err
+	}
+	tickets := make([]*chainhash.Hash, 0, len(missed))
+	for _, t := range missed {
+		tickets = append(tickets, t.(*chainhash.Hash))
+	}
+	return newRevocations(client, tickets, args)
+}
+
+func newRevocations(client coinharness.RPCClient, tickets []*chainhash.Hash, args *RevocationArgs) ([]*dcrutil.Tx, error) {
+	revocations := []*dcrutil.Tx{}
+	for _, ticketHash := range tickets {
+		ticket, err := fetchTicket(client, ticketHash)
+		if err != nil {
+			return nil, err
+		}
+		addr, err := ticketVotingAddress(ticket, args.Network)
+		if err != nil {
+			return nil, err
+		}
+		if !args.Keys.HasKey(addr) {
+			continue
+		}
+		revocation, err := NewRevocation(ticket, args)
+		if err != nil {
+			return nil, err
+		}
+		revocations = append(revocations, revocation)
+	}
+	return revocations, nil
+}
+
+// SendRevocation broadcasts the revocation to the node
+func SendRevocation(client coinharness.RPCClient, revocation *dcrutil.Tx) (coinharness.Hash, error) {
+	return client.SendRawTransaction(TransactionRawToTx(revocation.MsgTx()), false)
+}
+
+// MissedTickets collects tickets reported missed by the node. Plug
+// its OnSpentAndMissedTickets method into coinharness.NotificationHandlers
+// and register the client for spent and missed tickets notifications.
+// MissedTickets is safe for concurrent access.
+type MissedTickets struct {
+	mtx     sync.Mutex
+	tickets map[chainhash.Hash]int64
+}
+
+// OnSpentAndMissedTickets stores the missed tickets of the block,
+// spent tickets are ignored
+func (m *MissedTickets) OnSpentAndMissedTickets(hash coinharness.Hash, height int64, stakeDiff int64, tickets map[coinharness.Hash]bool) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.tickets == nil {
+		m.tickets = make(map[chainhash.Hash]int64)
+	}
+	for t, spent := range tickets {
+		if !spent {
+			m.tickets[t.(chainhash.Hash)] = height
+		}
+	}
+}
+
+// Revocations creates revocations for the collected missed tickets
+// controlled by the harness keys. Revoked tickets are forgotten.
+func (m *MissedTickets) Revocations(client coinharness.RPCClient, args *RevocationArgs) ([]*dcrutil.Tx, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	tickets := make([]*chainhash.Hash, 0, len(m.tickets))
+	for t := range m.tickets {
+		t := t
+		tickets = append(tickets, &t)
+	}
+	revocations, err := newRevocations(client, tickets, args)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range revocations {
+		delete(m.tickets, r.MsgTx().TxIn[0].PreviousOutPoint.Hash)
+	}
+	return revocations, nil
+}
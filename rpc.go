@@ -6,17 +6,37 @@ import (
 	"github.com/decred/dcrd/dcrjson"
 	"github.com/decred/dcrd/dcrutil"
 	"github.com/decred/dcrd/rpcclient"
+	"github.com/decred/dcrd/wire"
 	"github.com/jfixby/coin"
 	"github.com/jfixby/coinharness"
 	"github.com/jfixby/pin"
 	"io/ioutil"
+	"reflect"
 )
 
 type RPCClientFactory struct {
+	// Recorder records the traffic of every new connection when set,
+	// the entries of a connection are tagged with the host it connects to
+	Recorder *Recorder
+	// OnTxAcceptedVerbose is called for every transaction accepted to
+	// the mempool once NotifyNewTransactions(true) is requested
+	OnTxAcceptedVerbose func(tx *TxAcceptedVerbose)
 }
 
 func (f *RPCClientFactory) NewRPCConnection(config coinharness.RPCConnectionConfig, handlers *coinharness.NotificationHandlers) (coinharness.RPCClient, error) {
+	var recorder *Recorder
+	if f.Recorder != nil {
+		recorder = f.Recorder.ForClient(config.Host)
+		handlers = RecordNotifications(handlers, recorder)
+	}
 	h := ConvertHandlers(handlers)
+	onTxAcceptedVerbose := f.OnTxAcceptedVerbose
+	if onTxAcceptedVerbose != nil && recorder != nil {
+		onTxAcceptedVerbose = func(tx *TxAcceptedVerbose) {
+			recorder.Notification("OnTxAcceptedVerbose", tx.Tx, tx.Fee, tx.Size)
+			f.OnTxAcceptedVerbose(tx)
+		}
+	}
 
 	file := config.CertificateFile
 	fmt.Println("reading: " + file)
@@ -33,9 +53,16 @@ func (f *RPCClientFactory) NewRPCConnection(config coinharness.RPCConnectionConf
 		HTTPPostMode:         false,
 	}
 
-	return NewRPCClient(cfg, h)
+	client, err := newRPCClient(cfg, h, onTxAcceptedVerbose)
+	if err != nil {
+		return nil, err
+	}
+	client.SetRecorder(recorder)
+	return client, nil
 }
 
+// ConvertHandlers converts the harness handlers into the rpcclient ones,
+// absent harness handlers are skipped
 func ConvertHandlers(handlers *coinharness.NotificationHandlers) *rpcclient.NotificationHandlers {
 	if handlers == nil {
 		return nil
@@ -55,6 +82,9 @@ func ConvertHandlers(handlers *coinharness.NotificationHandlers) *rpcclient.Noti
 			blockHeight int64,
 			tickets []*chainhash.Hash,
 		) {
+			if handlers.OnWinningTickets == nil {
+				return
+			}
 			ts := []coinharness.Hash{}
 			for _, e := range tickets {
 				ts = append(ts, e)
@@ -72,6 +102,9 @@ func ConvertHandlers(handlers *coinharness.NotificationHandlers) *rpcclient.Noti
 			stakeDiff int64,
 			tickets map[chainhash.Hash]bool,
 		) {
+			if handlers.OnSpentAndMissedTickets == nil {
+				return
+			}
 			ts := make(map[coinharness.Hash]bool)
 			for k, v := range tickets {
 				ts[k] = v
@@ -90,6 +123,9 @@ func ConvertHandlers(handlers *coinharness.NotificationHandlers) *rpcclient.Noti
 			stakeDiff int64,
 			tickets []*chainhash.Hash,
 		) {
+			if handlers.OnNewTickets == nil {
+				return
+			}
 			ts := []coinharness.Hash{}
 			for _, e := range tickets {
 				ts = append(ts, e)
@@ -108,6 +144,9 @@ func ConvertHandlers(handlers *coinharness.NotificationHandlers) *rpcclient.Noti
 			height int64,
 			stakeDiff int64,
 		) {
+			if handlers.OnStakeDifficulty == nil {
+				return
+			}
 			handlers.OnStakeDifficulty(
 				hash,
 				height,
@@ -119,13 +158,17 @@ func ConvertHandlers(handlers *coinharness.NotificationHandlers) *rpcclient.Noti
 			hash *chainhash.Hash,
 			amount dcrutil.Amount,
 		) {
+			if handlers.OnTxAccepted == nil {
+				return
+			}
 			handlers.OnTxAccepted(
 				hash,
 				coin.Amount{int64(amount)},
 			)
 		},
 		//
-		//OnTxAcceptedVerbose:     handlers.OnTxAcceptedVerbose,
+		// OnTxAcceptedVerbose is set by RPCClientFactory,
+		// see newRPCClient
 		OnDcrdConnected: handlers.OnNodeConnected,
 		//
 		OnAccountBalance: func(
@@ -133,6 +176,9 @@ func ConvertHandlers(handlers *coinharness.NotificationHandlers) *rpcclient.Noti
 			balance dcrutil.Amount,
 			confirmed bool,
 		) {
+			if handlers.OnAccountBalance == nil {
+				return
+			}
 			handlers.OnAccountBalance(
 				account,
 				coin.Amount{int64(balance)},
@@ -146,6 +192,9 @@ func ConvertHandlers(handlers *coinharness.NotificationHandlers) *rpcclient.Noti
 			TxHash *chainhash.Hash,
 			amount dcrutil.Amount,
 		) {
+			if handlers.OnTicketsPurchased == nil {
+				return
+			}
 			handlers.OnTicketsPurchased(
 				TxHash,
 				coin.Amount{int64(amount)},
@@ -159,6 +208,9 @@ func ConvertHandlers(handlers *coinharness.NotificationHandlers) *rpcclient.Noti
 			sstxIn *chainhash.Hash,
 			voteBits uint16,
 		) {
+			if handlers.OnVotesCreated == nil {
+				return
+			}
 			handlers.OnVotesCreated(
 				txHash,
 				blockHash,
@@ -172,6 +224,9 @@ func ConvertHandlers(handlers *coinharness.NotificationHandlers) *rpcclient.Noti
 			txHash *chainhash.Hash,
 			sstxIn *chainhash.Hash,
 		) {
+			if handlers.OnRevocationsCreated == nil {
+				return
+			}
 			handlers.OnRevocationsCreated(
 				txHash,
 				sstxIn,
@@ -183,26 +238,77 @@ func ConvertHandlers(handlers *coinharness.NotificationHandlers) *rpcclient.Noti
 }
 
 func NewRPCClient(config *rpcclient.ConnConfig, handlers *rpcclient.NotificationHandlers) (coinharness.RPCClient, error) {
-	legacy, err := rpcclient.New(config, handlers)
+	client, err := newRPCClient(config, handlers, nil)
 	if err != nil {
 		return nil, err
 	}
+	return client, nil
+}
 
-	result := &RPCClient{rpc: legacy}
+func newRPCClient(config *rpcclient.ConnConfig, handlers *rpcclient.NotificationHandlers, onTxAcceptedVerbose func(tx *TxAcceptedVerbose)) (*RPCClient, error) {
+	notifier := newNotifier()
+	legacy, err := rpcclient.New(config, notifier.chain(handlers, onTxAcceptedVerbose))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RPCClient{rpc: legacy, notifier: notifier}
 	return result, nil
 }
 
 type RPCClient struct {
-	rpc *rpcclient.Client
+	rpc      *rpcclient.Client
+	notifier *notifier
+	recorder *Recorder
+}
+
+// SetRecorder makes the client record every call of its wrappers,
+// nil recorder stops the recording. Calls made through Internal()
+// bypass the recorder.
+func (c *RPCClient) SetRecorder(recorder *Recorder) {
+	c.recorder = recorder
+}
+
+// record records the request when the client has a recorder and returns
+// the function recording the response. The function takes pointers to
+// the results so that wrappers can defer it, nil stands for no result.
+func (c *RPCClient) record(method string, params ...interface{}) func(result interface{}, err *error) {
+	recorder := c.recorder
+	if recorder == nil {
+		return func(interface{}, *error) {}
+	}
+	seq := recorder.Request(method, params...)
+	return func(result interface{}, err *error) {
+		var e error
+		if err != nil {
+			e = *err
+		}
+		if result != nil {
+			result = reflect.ValueOf(result).Elem().Interface()
+		}
+		recorder.Response(seq, method, result, e)
+	}
+}
+
+// harnessClient returns the client as *RPCClient for the helpers that need
+// the dcrd specific wrappers
+func harnessClient(client coinharness.RPCClient) (*RPCClient, error) {
+	c, ok := client.(*RPCClient)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support dcrd specific calls",
+			client)
+	}
+	return c, nil
 }
 
-func (c *RPCClient) ListUnspent() ([]*coinharness.Unspent, error) {
-	result, err := c.rpc.ListUnspent()
+func (c *RPCClient) ListUnspent() (result []*coinharness.Unspent, err error) {
+	defer c.record("listunspent")(&result, &err)
+	legacy, err := c.rpc.ListUnspent()
 	if err != nil {
 		return nil, err
 	}
 	var r []*coinharness.Unspent
-	for _, e := range result {
+	for _, e := range legacy {
 		x := &coinharness.Unspent{}
 
 		x.TxID = e.TxID
@@ -223,39 +329,138 @@ func (c *RPCClient) ListUnspent() ([]*coinharness.Unspent, error) {
 	return r, nil
 }
 
-func (c *RPCClient) AddNode(args *coinharness.AddNodeArguments) error {
-	return c.rpc.AddNode(args.TargetAddr, args.Command.(rpcclient.AddNodeCommand))
+// AddNode accepts AddNodeCommand, rpcclient.AddNodeCommand or a plain
+// string as the command
+func (c *RPCClient) AddNode(args *coinharness.AddNodeArguments) (err error) {
+	defer c.record("addnode", args)(nil, &err)
+	var command rpcclient.AddNodeCommand
+	switch cmd := args.Command.(type) {
+	case AddNodeCommand:
+		command = rpcclient.AddNodeCommand(cmd)
+	case rpcclient.AddNodeCommand:
+		command = cmd
+	case string:
+		command = rpcclient.AddNodeCommand(cmd)
+	default:
+		return fmt.Errorf("unsupported addnode command: %v", args.Command)
+	}
+	return c.rpc.AddNode(args.TargetAddr, command)
 }
 
+// LoadTxFilter loads the tx filter matching the addresses,
+// see LoadTxFilterOutPoints for outpoints
 func (c *RPCClient) LoadTxFilter(reload bool, addr []coinharness.Address) error {
-	addresses := []dcrutil.Address{}
-	for _, e := range addr {
-		addresses = append(addresses, e.Internal().(dcrutil.Address))
-	}
-	return c.rpc.LoadTxFilter(reload, addresses, nil)
+	return c.LoadTxFilterOutPoints(reload, addr, nil)
 }
 
-func (c *RPCClient) SubmitBlock(block coinharness.Block) error {
+func (c *RPCClient) SubmitBlock(block coinharness.Block) (err error) {
+	defer c.record("submitblock", block)(nil, &err)
 	return c.rpc.SubmitBlock(block.(*dcrutil.Block), nil)
 }
 
+// Disconnect disconnects the client and closes its subscriptions
 func (c *RPCClient) Disconnect() {
+	defer c.record("disconnect")(nil, nil)
 	c.rpc.Disconnect()
+	c.notifier.close()
 }
 
+// Shutdown shuts the client down and closes its subscriptions
 func (c *RPCClient) Shutdown() {
+	defer c.record("shutdown")(nil, nil)
 	c.rpc.Shutdown()
+	c.notifier.close()
 }
 
-func (c *RPCClient) NotifyBlocks() error {
-	return c.rpc.NotifyBlocks()
+func (c *RPCClient) NotifyBlocks() (err error) {
+	defer c.record("notifyblocks")(nil, &err)
+	err = c.rpc.NotifyBlocks()
+	if err == nil {
+		c.notifier.register(BlockConnectedEventKind, BlockDisconnectedEventKind)
+	}
+	return err
 }
 
-func (c *RPCClient) GetBlockCount() (int64, error) {
+// StopNotifyBlocks cancels the NotifyBlocks() registration
+func (c *RPCClient) StopNotifyBlocks() (err error) {
+	defer c.record("stopnotifyblocks")(nil, &err)
+	err = c.rawRequest("stopnotifyblocks")
+	if err == nil {
+		c.notifier.unregister(BlockConnectedEventKind, BlockDisconnectedEventKind)
+	}
+	return err
+}
+
+// NotifyWinningTickets registers the client to receive the tickets
+// selected to vote on every new block. dcrd has no cancel counterpart.
+func (c *RPCClient) NotifyWinningTickets() (err error) {
+	defer c.record("notifywinningtickets")(nil, &err)
+	err = c.rpc.NotifyWinningTickets()
+	if err == nil {
+		c.notifier.register(WinningTicketsEventKind)
+	}
+	return err
+}
+
+// NotifySpentAndMissedTickets registers the client to receive the tickets
+// spent or missed by every new block. dcrd has no cancel counterpart.
+func (c *RPCClient) NotifySpentAndMissedTickets() (err error) {
+	defer c.record("notifyspentandmissedtickets")(nil, &err)
+	return c.rpc.NotifySpentAndMissedTickets()
+}
+
+// NotifyNewTickets registers the client to receive the tickets
+// purchased in every new block. dcrd has no cancel counterpart.
+func (c *RPCClient) NotifyNewTickets() (err error) {
+	defer c.record("notifynewtickets")(nil, &err)
+	err = c.rpc.NotifyNewTickets()
+	if err == nil {
+		c.notifier.register(NewTicketsEventKind)
+	}
+	return err
+}
+
+// NotifyStakeDifficulty registers the client to receive the stake
+// difficulty on every new block. dcrd has no cancel counterpart.
+func (c *RPCClient) NotifyStakeDifficulty() (err error) {
+	defer c.record("notifystakedifficulty")(nil, &err)
+	err = c.rpc.NotifyStakeDifficulty()
+	if err == nil {
+		c.notifier.register(StakeDifficultyEventKind)
+	}
+	return err
+}
+
+// NotifyNewTransactions registers the client to receive
+// transaction-accepted notifications, verbose ones when verbose is set
+func (c *RPCClient) NotifyNewTransactions(verbose bool) (err error) {
+	defer c.record("notifynewtransactions", verbose)(nil, &err)
+	err = c.rpc.NotifyNewTransactions(verbose)
+	if err == nil && verbose {
+		c.notifier.register(TxAcceptedVerboseEventKind)
+	} else if err == nil {
+		c.notifier.register(TxAcceptedEventKind)
+	}
+	return err
+}
+
+// StopNotifyNewTransactions cancels the NotifyNewTransactions() registration
+func (c *RPCClient) StopNotifyNewTransactions() (err error) {
+	defer c.record("stopnotifynewtransactions")(nil, &err)
+	err = c.rawRequest("stopnotifynewtransactions")
+	if err == nil {
+		c.notifier.unregister(TxAcceptedEventKind, TxAcceptedVerboseEventKind)
+	}
+	return err
+}
+
+func (c *RPCClient) GetBlockCount() (result int64, err error) {
+	defer c.record("getblockcount")(&result, &err)
 	return c.rpc.GetBlockCount()
 }
 
 func (c *RPCClient) Generate(blocks uint32) (result []coinharness.Hash, e error) {
+	defer c.record("generate", blocks)(&result, &e)
 	list, e := c.rpc.Generate(blocks)
 	if e != nil {
 		return nil, e
@@ -271,6 +476,7 @@ func (c *RPCClient) Internal() interface{} {
 }
 
 func (c *RPCClient) GetRawMempool(command interface{}) (result []coinharness.Hash, e error) {
+	defer c.record("getrawmempool", command)(&result, &e)
 	list, e := c.rpc.GetRawMempool(command.(dcrjson.GetRawMempoolTxTypeCmd))
 	if e != nil {
 		return nil, e
@@ -282,64 +488,109 @@ func (c *RPCClient) GetRawMempool(command interface{}) (result []coinharness.Has
 }
 
 func (c *RPCClient) SendRawTransaction(tx *coinharness.MessageTx, allowHighFees bool) (result coinharness.Hash, e error) {
+	defer c.record("sendrawtransaction", tx, allowHighFees)(&result, &e)
 	txx := TransactionTxToRaw(tx)
 	r, e := c.rpc.SendRawTransaction(txx, allowHighFees)
 	return r, e
 }
 
+// GetBlock loads the full block through GetMsgBlock and returns it in the
+// coinharness.MsgBlock form, which only has room for the regular tree.
+// Use GetFullBlock() when the header or the stake tree are needed.
 func (c *RPCClient) GetBlock(hash coinharness.Hash) (*coinharness.MsgBlock, error) {
-	block, err := c.rpc.GetBlock(hash.(*chainhash.Hash)) //*wire.MsgBlock
+	block, err := c.GetMsgBlock(hash)
 	if err != nil {
 		return nil, err
 	}
+	return block.HarnessBlock(), nil
+}
 
-	b := &coinharness.MsgBlock{}
-
-	ttx := []*coinharness.MessageTx{}
-	for _, ti := range block.Transactions {
-		ttx = append(ttx,
-			TransactionRawToTx(ti),
-		)
+// GetMsgBlock returns the block with the given hash including
+// its header and the stake tree
+func (c *RPCClient) GetMsgBlock(hash coinharness.Hash) (*MsgBlock, error) {
+	block, err := c.rawBlock(hash.(*chainhash.Hash))
+	if err != nil {
+		return nil, err
 	}
+	return BlockRawToMsgBlock(block), nil
+}
 
-	b.Transactions = ttx
-
-	return b, nil
+// rawBlock returns the block in the wire form for the helpers
+// that build on top of it
+func (c *RPCClient) rawBlock(hash *chainhash.Hash) (result *wire.MsgBlock, err error) {
+	defer c.record("getblock", hash)(&result, &err)
+	return c.rpc.GetBlock(hash)
 }
 
 func (c *RPCClient) GetPeerInfo() ([]coinharness.PeerInfo, error) {
-	pif, err := c.rpc.GetPeerInfo()
+	pif, err := c.GetPeerInfoFull()
 	if err != nil {
 		return nil, err
 	}
 
 	l := []coinharness.PeerInfo{}
 	for _, i := range pif {
-		inf := coinharness.PeerInfo{}
+		l = append(l, i.PeerInfo)
+	}
+	return l, nil
+}
+
+// GetPeerInfoFull returns the connection details of every peer of the node
+func (c *RPCClient) GetPeerInfoFull() (result []*PeerInfo, err error) {
+	defer c.record("getpeerinfo")(&result, &err)
+	pif, err := c.rpc.GetPeerInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	l := []*PeerInfo{}
+	for _, i := range pif {
+		inf := &PeerInfo{
+			ID:             i.ID,
+			AddrLocal:      i.AddrLocal,
+			Services:       i.Services,
+			RelayTxes:      i.RelayTxes,
+			LastSend:       i.LastSend,
+			LastRecv:       i.LastRecv,
+			BytesSent:      i.BytesSent,
+			BytesRecv:      i.BytesRecv,
+			ConnTime:       i.ConnTime,
+			TimeOffset:     i.TimeOffset,
+			PingTime:       i.PingTime,
+			PingWait:       i.PingWait,
+			Version:        i.Version,
+			SubVer:         i.SubVer,
+			Inbound:        i.Inbound,
+			StartingHeight: i.StartingHeight,
+			CurrentHeight:  i.CurrentHeight,
+			BanScore:       i.BanScore,
+			SyncNode:       i.SyncNode,
+		}
 		inf.Addr = i.Addr
 		l = append(l, inf)
-
 	}
 	return l, nil
 }
 
-func (c *RPCClient) GetNewAddress(account string) (coinharness.Address, error) {
+func (c *RPCClient) GetNewAddress(account string) (result coinharness.Address, err error) {
+	defer c.record("getnewaddress", account)(&result, &err)
 	legacy, err := c.rpc.GetNewAddress(account)
 	if err != nil {
 		return nil, err
 	}
 
-	result := &Address{Address: legacy}
+	result = &Address{Address: legacy}
 	return result, nil
 }
 
-func (c *RPCClient) ValidateAddress(address coinharness.Address) (*coinharness.ValidateAddressResult, error) {
+func (c *RPCClient) ValidateAddress(address coinharness.Address) (result *coinharness.ValidateAddressResult, err error) {
+	defer c.record("validateaddress", address)(&result, &err)
 	legacy, err := c.rpc.ValidateAddress(address.Internal().(dcrutil.Address))
 	// *dcrjson.ValidateAddressWalletResult
 	if err != nil {
 		return nil, err
 	}
-	result := &coinharness.ValidateAddressResult{
+	result = &coinharness.ValidateAddressResult{
 		Address:      legacy.Address,
 		Account:      legacy.Account,
 		IsValid:      legacy.IsValid,
@@ -349,22 +600,38 @@ func (c *RPCClient) ValidateAddress(address coinharness.Address) (*coinharness.V
 	return result, nil
 }
 
-func (c *RPCClient) GetBalance() (*coinharness.GetBalanceResult, error) {
+func (c *RPCClient) GetBalance() (result *coinharness.GetBalanceResult, err error) {
+	defer c.record("getbalance", "*")(&result, &err)
 	legacy, err := c.rpc.GetBalance("*")
-	// *dcrjson.ValidateAddressWalletResult
 	if err != nil {
 		return nil, err
 	}
+	return convertBalance(legacy), nil
+}
+
+// GetBalanceMinConf returns the balance of the account counting only
+// transactions with at least minconf confirmations, "*" stands for
+// all accounts
+func (c *RPCClient) GetBalanceMinConf(account string, minconf int) (result *coinharness.GetBalanceResult, err error) {
+	defer c.record("getbalance", account, minconf)(&result, &err)
+	legacy, err := c.rpc.GetBalanceMinConf(account, minconf)
+	if err != nil {
+		return nil, err
+	}
+	return convertBalance(legacy), nil
+}
+
+func convertBalance(legacy *dcrjson.GetBalanceResult) *coinharness.GetBalanceResult {
 	result := &coinharness.GetBalanceResult{
-		BlockHash: legacy.BlockHash,
-		//TotalSpendable:   coin.FromFloat(legacy.TotalSpendable),
-		//TotalUnconfirmed: coin.FromFloat(legacy.TotalUnconfirmed),
-		//
-		//CumulativeTotal:              coin.FromFloat(legacy.CumulativeTotal),
-		//TotalVotingAuthority:         coin.FromFloat(legacy.TotalVotingAuthority),
-		//TotalLockedByTickets:         coin.FromFloat(legacy.TotalLockedByTickets),
-		//TotalImmatureStakeGeneration: coin.FromFloat(legacy.TotalImmatureStakeGeneration),
-		//TotalImmatureCoinbaseRewards: coin.FromFloat(legacy.TotalImmatureCoinbaseRewards),
+		BlockHash:        legacy.BlockHash,
+		TotalSpendable:   coin.FromFloat(legacy.TotalSpendable),
+		TotalUnconfirmed: coin.FromFloat(legacy.TotalUnconfirmed),
+
+		CumulativeTotal:              coin.FromFloat(legacy.CumulativeTotal),
+		TotalVotingAuthority:         coin.FromFloat(legacy.TotalVotingAuthority),
+		TotalLockedByTickets:         coin.FromFloat(legacy.TotalLockedByTickets),
+		TotalImmatureStakeGeneration: coin.FromFloat(legacy.TotalImmatureStakeGeneration),
+		TotalImmatureCoinbaseRewards: coin.FromFloat(legacy.TotalImmatureCoinbaseRewards),
 	}
 	result.Balances = make(map[string]coinharness.GetAccountBalanceResult)
 	for _, v := range legacy.Balances {
@@ -376,18 +643,30 @@ func (c *RPCClient) GetBalance() (*coinharness.GetBalanceResult, error) {
 			LockedByTickets:         coin.FromFloat(v.LockedByTickets),
 			VotingAuthority:         coin.FromFloat(v.VotingAuthority),
 			ImmatureCoinbaseRewards: coin.FromFloat(v.ImmatureCoinbaseRewards),
+			ImmatureStakeGeneration: coin.FromFloat(v.ImmatureStakeGeneration),
 		}
 		result.Balances[v.AccountName] = x
 	}
 
-	return result, nil
+	return result
 }
 
 func (c *RPCClient) GetBestBlock() (coinharness.Hash, int64, error) {
-	return c.rpc.GetBestBlock()
+	done := c.record("getbestblock")
+	hash, height, err := c.rpc.GetBestBlock()
+	var result *bestBlockResult
+	if err == nil {
+		result = &bestBlockResult{
+			Hash:   hash.String(),
+			Height: height,
+		}
+	}
+	done(&result, &err)
+	return hash, height, err
 }
 
-func (c *RPCClient) ListAccounts() (map[string]coin.Amount, error) {
+func (c *RPCClient) ListAccounts() (result map[string]coin.Amount, err error) {
+	defer c.record("listaccounts")(&result, &err)
 	l, err := c.rpc.ListAccounts()
 	if err != nil {
 		return nil, err
@@ -400,36 +679,60 @@ func (c *RPCClient) ListAccounts() (map[string]coin.Amount, error) {
 	return r, nil
 }
 
-func (c *RPCClient) CreateNewAccount(account string) error {
+func (c *RPCClient) CreateNewAccount(account string) (err error) {
+	defer c.record("createnewaccount", account)(nil, &err)
 	return c.rpc.CreateNewAccount(account)
 }
 
-func (c *RPCClient) WalletLock() error {
+func (c *RPCClient) WalletLock() (err error) {
+	defer c.record("walletlock")(nil, &err)
 	return c.rpc.WalletLock()
 }
 
-func (c *RPCClient) WalletInfo() (*coinharness.WalletInfoResult, error) {
+func (c *RPCClient) WalletInfo() (result *coinharness.WalletInfoResult, err error) {
+	defer c.record("walletinfo")(&result, &err)
 	r, err := c.rpc.WalletInfo()
 	if err != nil {
 		return nil, err
 	}
-	result := &coinharness.WalletInfoResult{
-		Unlocked:        r.Unlocked,
-		DaemonConnected: r.DaemonConnected,
-		Voting:          r.DaemonConnected,
+	result = &coinharness.WalletInfoResult{
+		Unlocked:         r.Unlocked,
+		DaemonConnected:  r.DaemonConnected,
+		Voting:           r.Voting,
+		TicketFee:        coin.FromFloat(r.TicketFee),
+		TicketPurchasing: r.TicketPurchasing,
+		VoteBits:         r.VoteBits,
+		VoteBitsExtended: r.VoteBitsExtended,
+		VoteVersion:      r.VoteVersion,
+		TxFee:            coin.FromFloat(r.TxFee),
 	}
 	return result, nil
 }
 
-func (c *RPCClient) WalletUnlock(passphrase string, timeoutSecs int64) error {
+func (c *RPCClient) WalletUnlock(passphrase string, timeoutSecs int64) (err error) {
+	defer c.record("walletpassphrase", "***", timeoutSecs)(nil, &err)
 	return c.rpc.WalletPassphrase(passphrase, timeoutSecs)
 }
 
-func (c *RPCClient) GetBuildVersion() (coinharness.BuildVersion, error) {
-	//legacy, err := c.rpc.GetBuildVersion()
-	//if err != nil {
-	//	return nil, err
-	//}
-	//return legacy, nil
-	return nil, fmt.Errorf("decred does not support this feature (GetBuildVersion)")
+// GetBuildVersion returns the *BuildVersion reported by the version RPC
+func (c *RPCClient) GetBuildVersion() (result coinharness.BuildVersion, err error) {
+	defer c.record("version")(&result, &err)
+	legacy, err := c.rpc.Version()
+	if err != nil {
+		return nil, err
+	}
+	version := &BuildVersion{
+		Components: make(map[string]*SemVer),
+	}
+	for k, v := range legacy {
+		version.Components[k] = &SemVer{
+			VersionString: v.VersionString,
+			Major:         v.Major,
+			Minor:         v.Minor,
+			Patch:         v.Patch,
+			Prerelease:    v.Prerelease,
+			BuildMetadata: v.BuildMetadata,
+		}
+	}
+	return version, nil
 }
@@ -0,0 +1,168 @@
+package dcrharness
+
+import (
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrjson"
+	"github.com/jfixby/coin"
+	"github.com/jfixby/coinharness"
+)
+
+// BlockVerboseResult is the harness representation of
+// dcrjson.GetBlockVerboseResult, RawTx and RawSTx are populated
+// only when verbose transactions are requested
+type BlockVerboseResult struct {
+	Hash          string
+	Confirmations int64
+	Size          int32
+	Height        int64
+	Version       int32
+	MerkleRoot    string
+	StakeRoot     string
+	Tx            []string
+	RawTx         []*TxRawResult
+	STx           []string
+	RawSTx        []*TxRawResult
+	Time          int64
+	Nonce         uint32
+	VoteBits      uint16
+	FinalState    string
+	Voters        uint16
+	FreshStake    uint8
+	Revocations   uint8
+	PoolSize      uint32
+	Bits          string
+	SBits         coin.Amount
+	ExtraData     string
+	StakeVersion  uint32
+	Difficulty    float64
+	ChainWork     string
+	PreviousHash  string
+	NextHash      string
+}
+
+// AgendaInfo is the harness representation of dcrjson.AgendaInfo
+type AgendaInfo struct {
+	Status     string
+	Since      int64
+	StartTime  uint64
+	ExpireTime uint64
+}
+
+// BlockChainInfoResult is the harness representation of
+// dcrjson.GetBlockChainInfoResult
+type BlockChainInfoResult struct {
+	Chain                string
+	Blocks               int64
+	Headers              int64
+	SyncHeight           int64
+	BestBlockHash        string
+	Difficulty           uint32
+	DifficultyRatio      float64
+	VerificationProgress float64
+	ChainWork            string
+	InitialBlockDownload bool
+	MaxBlockSize         int64
+	Deployments          map[string]AgendaInfo
+}
+
+func (c *RPCClient) GetBlockHash(height int64) (result coinharness.Hash, err error) {
+	defer c.record("getblockhash", height)(&result, &err)
+	return c.rpc.GetBlockHash(height)
+}
+
+func (c *RPCClient) GetBlockHeader(hash coinharness.Hash) (result *MsgBlockHeader, err error) {
+	defer c.record("getblockheader", hash)(&result, &err)
+	legacy, err := c.rpc.GetBlockHeader(hash.(*chainhash.Hash))
+	if err != nil {
+		return nil, err
+	}
+	header := BlockHeaderRawToHeader(legacy)
+	return &header, nil
+}
+
+func (c *RPCClient) GetBlockVerbose(hash coinharness.Hash, verboseTx bool) (result *BlockVerboseResult, err error) {
+	defer c.record("getblock", hash, true, verboseTx)(&result, &err)
+	r, err := c.rpc.GetBlockVerbose(hash.(*chainhash.Hash), verboseTx)
+	if err != nil {
+		return nil, err
+	}
+	result = &BlockVerboseResult{
+		Hash:          r.Hash,
+		Confirmations: r.Confirmations,
+		Size:          r.Size,
+		Height:        r.Height,
+		Version:       r.Version,
+		MerkleRoot:    r.MerkleRoot,
+		StakeRoot:     r.StakeRoot,
+		Tx:            r.Tx,
+		STx:           r.STx,
+		Time:          r.Time,
+		Nonce:         r.Nonce,
+		VoteBits:      r.VoteBits,
+		FinalState:    r.FinalState,
+		Voters:        r.Voters,
+		FreshStake:    r.FreshStake,
+		Revocations:   r.Revocations,
+		PoolSize:      r.PoolSize,
+		Bits:          r.Bits,
+		SBits:         coin.FromFloat(r.SBits),
+		ExtraData:     r.ExtraData,
+		StakeVersion:  r.StakeVersion,
+		Difficulty:    r.Difficulty,
+		ChainWork:     r.ChainWork,
+		PreviousHash:  r.PreviousHash,
+		NextHash:      r.NextHash,
+	}
+	result.RawTx, err = convertTxRawResults(r.RawTx)
+	if err != nil {
+		return nil, err
+	}
+	result.RawSTx, err = convertTxRawResults(r.RawSTx)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *RPCClient) GetBlockChainInfo() (result *BlockChainInfoResult, err error) {
+	defer c.record("getblockchaininfo")(&result, &err)
+	r, err := c.rpc.GetBlockChainInfo()
+	if err != nil {
+		return nil, err
+	}
+	result = &BlockChainInfoResult{
+		Chain:                r.Chain,
+		Blocks:               r.Blocks,
+		Headers:              r.Headers,
+		SyncHeight:           r.SyncHeight,
+		BestBlockHash:        r.BestBlockHash,
+		Difficulty:           r.Difficulty,
+		DifficultyRatio:      r.DifficultyRatio,
+		VerificationProgress: r.VerificationProgress,
+		ChainWork:            r.ChainWork,
+		InitialBlockDownload: r.InitialBlockDownload,
+		MaxBlockSize:         r.MaxBlockSize,
+		Deployments:          make(map[string]AgendaInfo),
+	}
+	for k, v := range r.Deployments {
+		result.Deployments[k] = AgendaInfo{
+			Status:     v.Status,
+			Since:      v.Since,
+			StartTime:  v.StartTime,
+			ExpireTime: v.ExpireTime,
+		}
+	}
+	return result, nil
+}
+
+func convertTxRawResults(list []dcrjson.TxRawResult) ([]*TxRawResult, error) {
+	result := []*TxRawResult{}
+	for i := range list {
+		tx, err := convertTxRawResult(&list[i])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, tx)
+	}
+	return result, nil
+}
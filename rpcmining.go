@@ -0,0 +1,129 @@
+package dcrharness
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"github.com/decred/dcrd/wire"
+)
+
+// MiningInfoResult is the harness representation of
+// dcrjson.GetMiningInfoResult
+type MiningInfoResult struct {
+	Blocks           int64
+	CurrentBlockSize uint64
+	CurrentBlockTx   uint64
+	Difficulty       float64
+	StakeDifficulty  int64
+	Errors           string
+	Generate         bool
+	GenProcLimit     int32
+	HashesPerSec     int64
+	NetworkHashPS    int64
+	PooledTx         uint64
+	TestNet          bool
+}
+
+// WorkResult is the harness representation of dcrjson.GetWorkResult.
+// Header is the header of the block template built by the node.
+type WorkResult struct {
+	Data   string
+	Target string
+	Header MsgBlockHeader
+	header wire.BlockHeader
+	data   []byte
+}
+
+// GetWork returns the block template the node has built for the next block
+func (c *RPCClient) GetWork() (result *WorkResult, err error) {
+	defer c.record("getwork")(&result, &err)
+	r, err := c.rpc.GetWork()
+	if err != nil {
+		return nil, err
+	}
+	data, err := hex.DecodeString(r.Data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < wire.MaxBlockHeaderPayload {
+		return nil, fmt.Errorf("unexpected getwork data length %v",
+			len(data))
+	}
+	result = &WorkResult{
+		Data:   r.Data,
+		Target: r.Target,
+		data:   data,
+	}
+	if err := result.header.FromBytes(data[:wire.MaxBlockHeaderPayload]); err != nil {
+		return nil, err
+	}
+	result.Header = BlockHeaderRawToHeader(&result.header)
+	return result, nil
+}
+
+// SolveWork solves the proof of work of the block template and returns
+// the data to be passed to SubmitWork
+func SolveWork(ctx context.Context, work *WorkResult) (string, error) {
+	header := work.header
+	if err := SolveBlock(ctx, &header); err != nil {
+		return "", err
+	}
+	headerBytes, err := header.Bytes()
+	if err != nil {
+		return "", err
+	}
+	data := make([]byte, len(work.data))
+	copy(data, work.data)
+	copy(data, headerBytes)
+	return hex.EncodeToString(data), nil
+}
+
+// SubmitWork submits the solved getwork data, false is returned
+// when the node rejects the solution
+func (c *RPCClient) SubmitWork(data string) (result bool, err error) {
+	defer c.record("getwork", data)(&result, &err)
+	return c.rpc.GetWorkSubmit(data)
+}
+
+// SetGenerate turns the node's CPU miner on or off
+func (c *RPCClient) SetGenerate(enable bool, numCPUs int) (err error) {
+	defer c.record("setgenerate", enable, numCPUs)(nil, &err)
+	return c.rpc.SetGenerate(enable, numCPUs)
+}
+
+func (c *RPCClient) GetGenerate() (result bool, err error) {
+	defer c.record("getgenerate")(&result, &err)
+	return c.rpc.GetGenerate()
+}
+
+func (c *RPCClient) GetMiningInfo() (result *MiningInfoResult, err error) {
+	defer c.record("getmininginfo")(&result, &err)
+	r, err := c.rpc.GetMiningInfo()
+	if err != nil {
+		return nil, err
+	}
+	return &MiningInfoResult{
+		Blocks:           r.Blocks,
+		CurrentBlockSize: r.CurrentBlockSize,
+		CurrentBlockTx:   r.CurrentBlockTx,
+		Difficulty:       r.Difficulty,
+		StakeDifficulty:  r.StakeDifficulty,
+		Errors:           r.Errors,
+		Generate:         r.Generate,
+		GenProcLimit:     r.GenProcLimit,
+		HashesPerSec:     r.HashesPerSec,
+		NetworkHashPS:    r.NetworkHashPS,
+		PooledTx:         r.PooledTx,
+		TestNet:          r.TestNet,
+	}, nil
+}
+
+func (c *RPCClient) GetHashesPerSec() (result int64, err error) {
+	defer c.record("gethashespersec")(&result, &err)
+	return c.rpc.GetHashesPerSec()
+}
+
+func (c *RPCClient) GetDifficulty() (result float64, err error) {
+	defer c.record("getdifficulty")(&result, &err)
+	return c.rpc.GetDifficulty()
+}
@@ -0,0 +1,120 @@
+package dcrharness
+
+import (
+	"github.com/decred/dcrd/dcrjson"
+)
+
+// AddNodeCommand enumerates the commands of the AddNode RPC
+type AddNodeCommand string
+
+const (
+	// AddNodeAdd adds the peer to the persistent peers list and connects to it
+	AddNodeAdd AddNodeCommand = "add"
+
+	// AddNodeRemove removes the peer from the persistent peers list
+	AddNodeRemove AddNodeCommand = "remove"
+
+	// AddNodeOneTry tries to connect to the peer once
+	AddNodeOneTry AddNodeCommand = "onetry"
+)
+
+// NodeCommand enumerates the commands of the Node RPC
+type NodeCommand string
+
+const (
+	// NodeConnect connects to the peer
+	NodeConnect NodeCommand = "connect"
+
+	// NodeRemove removes the persistent peer
+	NodeRemove NodeCommand = "remove"
+
+	// NodeDisconnect disconnects from the peer
+	NodeDisconnect NodeCommand = "disconnect"
+)
+
+// AddedNodeAddress is the harness representation of
+// dcrjson.GetAddedNodeInfoResultAddr
+type AddedNodeAddress struct {
+	Address   string
+	Connected string
+}
+
+// AddedNodeInfo is the harness representation of
+// dcrjson.GetAddedNodeInfoResult
+type AddedNodeInfo struct {
+	AddedNode string
+	Connected *bool
+	Addresses []AddedNodeAddress
+}
+
+// NetTotalsResult is the harness representation of dcrjson.GetNetTotalsResult
+type NetTotalsResult struct {
+	TotalBytesRecv uint64
+	TotalBytesSent uint64
+	TimeMillis     int64
+}
+
+// Node connects to or disconnects from the peer with the given address,
+// permanent makes a connection persistent
+func (c *RPCClient) Node(command NodeCommand, addr string, permanent bool) (err error) {
+	defer c.record("node", command, addr, permanent)(nil, &err)
+	var connectSubCmd *string
+	if command == NodeConnect {
+		sub := "temp"
+		if permanent {
+			sub = "perm"
+		}
+		connectSubCmd = &sub
+	}
+	return c.rpc.Node(dcrjson.NodeSubCmd(command), addr, connectSubCmd)
+}
+
+// GetAddedNodeInfo returns the persistent peers added by AddNode,
+// an empty addr stands for all of them
+func (c *RPCClient) GetAddedNodeInfo(addr string) (result []*AddedNodeInfo, err error) {
+	defer c.record("getaddednodeinfo", addr)(&result, &err)
+	list, err := c.rpc.GetAddedNodeInfo(addr)
+	if err != nil {
+		return nil, err
+	}
+	result = []*AddedNodeInfo{}
+	for _, e := range list {
+		info := &AddedNodeInfo{
+			AddedNode: e.AddedNode,
+			Connected: e.Connected,
+		}
+		if e.Addresses != nil {
+			for _, a := range *e.Addresses {
+				info.Addresses = append(info.Addresses, AddedNodeAddress{
+					Address:   a.Address,
+					Connected: a.Connected,
+				})
+			}
+		}
+		result = append(result, info)
+	}
+	return result, nil
+}
+
+func (c *RPCClient) GetConnectionCount() (result int64, err error) {
+	defer c.record("getconnectioncount")(&result, &err)
+	return c.rpc.GetConnectionCount()
+}
+
+func (c *RPCClient) Ping() (err error) {
+	defer c.record("ping")(nil, &err)
+	return c.rpc.Ping()
+}
+
+func (c *RPCClient) GetNetTotals() (result *NetTotalsResult, err error) {
+	defer c.record("getnettotals")(&result, &err)
+	r, err := c.rpc.GetNetTotals()
+	if err != nil {
+		return nil, err
+	}
+	return &NetTotalsResult{
+		TotalBytesRecv: r.TotalBytesRecv,
+		TotalBytesSent: r.TotalBytesSent,
+		TimeMillis:     r.TimeMillis,
+	}, nil
+}
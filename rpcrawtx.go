@@ -0,0 +1,233 @@
+package dcrharness
+
+import (
+	"encoding/hex"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrjson"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/wire"
+	"github.com/jfixby/coin"
+	"github.com/jfixby/coinharness"
+)
+
+// TxRawVin is the harness representation of dcrjson.Vin
+type TxRawVin struct {
+	Coinbase     string
+	Stakebase    string
+	Txid         string
+	Vout         uint32
+	Tree         int8
+	Sequence     uint32
+	AmountIn     coin.Amount
+	BlockHeight  uint32
+	BlockIndex   uint32
+	ScriptSigAsm string
+	ScriptSigHex string
+}
+
+// TxRawVout is the harness representation of dcrjson.Vout
+type TxRawVout struct {
+	Value        coin.Amount
+	N            uint32
+	Version      uint16
+	ScriptAsm    string
+	ScriptHex    string
+	ReqSigs      int32
+	ScriptType   string
+	Addresses    []string
+	CommitAmount *coin.Amount
+}
+
+// TxRawResult is the harness representation of dcrjson.TxRawResult,
+// Tx holds the decoded transaction
+type TxRawResult struct {
+	Tx            *coinharness.MessageTx
+	Txid          string
+	Version       int32
+	LockTime      uint32
+	Expiry        uint32
+	Vin           []TxRawVin
+	Vout          []TxRawVout
+	BlockHash     string
+	BlockHeight   int64
+	BlockIndex    uint32
+	Confirmations int64
+	Time          int64
+	Blocktime     int64
+}
+
+// MempoolTxResult is the harness representation of
+// dcrjson.GetRawMempoolVerboseResult
+type MempoolTxResult struct {
+	Size             int32
+	Fee              coin.Amount
+	Time             int64
+	Height           int64
+	StartingPriority float64
+	CurrentPriority  float64
+	Depends          []string
+}
+
+// MempoolInfoResult is the harness representation of
+// dcrjson.GetMempoolInfoResult
+type MempoolInfoResult struct {
+	Size  int64
+	Bytes int64
+}
+
+func (c *RPCClient) GetRawTransaction(hash coinharness.Hash) (*coinharness.MessageTx, error) {
+	tx, err := c.rawTransaction(hash.(*chainhash.Hash))
+	if err != nil {
+		return nil, err
+	}
+	return TransactionRawToTx(tx), nil
+}
+
+// rawTransaction returns the transaction in the wire form for the helpers
+// that spend or hash it
+func (c *RPCClient) rawTransaction(hash *chainhash.Hash) (result *wire.MsgTx, err error) {
+	defer c.record("getrawtransaction", hash)(&result, &err)
+	tx, err := c.rpc.GetRawTransaction(hash)
+	if err != nil {
+		return nil, err
+	}
+	return tx.MsgTx(), nil
+}
+
+func (c *RPCClient) GetRawTransactionVerbose(hash coinharness.Hash) (result *TxRawResult, err error) {
+	defer c.record("getrawtransaction", hash, 1)(&result, &err)
+	r, err := c.rpc.GetRawTransactionVerbose(hash.(*chainhash.Hash))
+	if err != nil {
+		return nil, err
+	}
+	return convertTxRawResult(r)
+}
+
+// DecodeRawTransaction makes the node decode the transaction
+func (c *RPCClient) DecodeRawTransaction(tx *coinharness.MessageTx) (result *TxRawResult, err error) {
+	defer c.record("decoderawtransaction", tx)(&result, &err)
+	txBytes, err := TransactionTxToRaw(tx).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.rpc.DecodeRawTransaction(txBytes)
+	if err != nil {
+		return nil, err
+	}
+	result, err = convertTxRawResult(r)
+	if err != nil {
+		return nil, err
+	}
+	// decoderawtransaction reports no hex, the input is the transaction
+	result.Tx = tx
+	return result, nil
+}
+
+// GetRawMempoolVerbose returns the mempool transactions of the given type
+// by their id
+func (c *RPCClient) GetRawMempoolVerbose(txType dcrjson.GetRawMempoolTxTypeCmd) (result map[string]*MempoolTxResult, err error) {
+	defer c.record("getrawmempool", true, txType)(&result, &err)
+	r, err := c.rpc.GetRawMempoolVerbose(txType)
+	if err != nil {
+		return nil, err
+	}
+	result = make(map[string]*MempoolTxResult)
+	for k, v := range r {
+		result[k] = &MempoolTxResult{
+			Size:             v.Size,
+			Fee:              coin.FromFloat(v.Fee),
+			Time:             v.Time,
+			Height:           v.Height,
+			StartingPriority: v.StartingPriority,
+			CurrentPriority:  v.CurrentPriority,
+			Depends:          v.Depends,
+		}
+	}
+	return result, nil
+}
+
+func (c *RPCClient) GetMempoolInfo() (result *MempoolInfoResult, err error) {
+	defer c.record("getmempoolinfo")(&result, &err)
+	r := &dcrjson.GetMempoolInfoResult{}
+	if err := c.rawRequestResult("getmempoolinfo", r); err != nil {
+		return nil, err
+	}
+	return &MempoolInfoResult{
+		Size:  r.Size,
+		Bytes: r.Bytes,
+	}, nil
+}
+
+// SearchRawTransactions returns transactions involving the address,
+// it requires the node to run with the address index
+func (c *RPCClient) SearchRawTransactions(address coinharness.Address, skip, count int, reverse bool) (result []*coinharness.MessageTx, err error) {
+	defer c.record("searchrawtransactions", address, skip, count, reverse)(&result, &err)
+	list, err := c.rpc.SearchRawTransactions(
+		address.Internal().(dcrutil.Address), skip, count, reverse, nil)
+	if err != nil {
+		return nil, err
+	}
+	result = []*coinharness.MessageTx{}
+	for _, tx := range list {
+		result = append(result, TransactionRawToTx(tx))
+	}
+	return result, nil
+}
+
+func convertTxRawResult(r *dcrjson.TxRawResult) (*TxRawResult, error) {
+	result := &TxRawResult{
+		Txid:          r.Txid,
+		Version:       r.Version,
+		LockTime:      r.LockTime,
+		Expiry:        r.Expiry,
+		BlockHash:     r.BlockHash,
+		BlockHeight:   r.BlockHeight,
+		BlockIndex:    r.BlockIndex,
+		Confirmations: r.Confirmations,
+		Time:          r.Time,
+		Blocktime:     r.Blocktime,
+	}
+	if r.Hex != "" {
+		txBytes, err := hex.DecodeString(r.Hex)
+		if err != nil {
+			return nil, err
+		}
+		tx := &wire.MsgTx{}
+		if err := tx.FromBytes(txBytes); err != nil {
+			return nil, err
+		}
+		result.Tx = TransactionRawToTx(tx)
+	}
+	for _, in := range r.Vin {
+		vin := TxRawVin{
+			Coinbase:    in.Coinbase,
+			Stakebase:   in.Stakebase,
+			Txid:        in.Txid,
+			Vout:        in.Vout,
+			Tree:        in.Tree,
+			Sequence:    in.Sequence,
+			AmountIn:    coin.FromFloat(in.AmountIn),
+			BlockHeight: in.BlockHeight,
+			BlockIndex:  in.BlockIndex,
+		}
+		if in.ScriptSig != nil {
+			vin.ScriptSigAsm = in.ScriptSig.Asm
+			vin.ScriptSigHex = in.ScriptSig.Hex
+		}
+		result.Vin = append(result.Vin, vin)
+	}
+	for _, out := range r.Vout {
+		result.Vout = append(result.Vout, TxRawVout{
+			Value:        coin.FromFloat(out.Value),
+			N:            out.N,
+			Version:      out.Version,
+			ScriptAsm:    out.ScriptPubKey.Asm,
+			ScriptHex:    out.ScriptPubKey.Hex,
+			ReqSigs:      out.ScriptPubKey.ReqSigs,
+			ScriptType:   out.ScriptPubKey.Type,
+			Addresses:    out.ScriptPubKey.Addresses,
+			CommitAmount: amountFromFloatPtr(out.ScriptPubKey.CommitAmt),
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,274 @@
+package dcrharness
+
+import (
+	"encoding/json"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/jfixby/coin"
+	"github.com/jfixby/coinharness"
+)
+
+// PurchaseTicketArgs bundles PurchaseTicket() arguments,
+// nil fields are omitted and the wallet defaults are used instead
+type PurchaseTicketArgs struct {
+	Account       string
+	SpendLimit    coin.Amount
+	MinConf       *int
+	TicketAddress coinharness.Address
+	NumTickets    *int
+	PoolAddress   coinharness.Address
+	PoolFees      *coin.Amount
+	Expiry        *int
+	TicketChange  *bool
+	TicketFee     *coin.Amount
+}
+
+// StakeInfoResult is the harness representation of dcrjson.GetStakeInfoResult
+type StakeInfoResult struct {
+	BlockHeight      int64
+	Difficulty       coin.Amount
+	TotalSubsidy     coin.Amount
+	OwnMempoolTix    uint32
+	Immature         uint32
+	Unspent          uint32
+	Voted            uint32
+	Revoked          uint32
+	UnspentExpired   uint32
+	PoolSize         uint32
+	AllMempoolTix    uint32
+	Live             uint32
+	ProportionLive   float64
+	Missed           uint32
+	ProportionMissed float64
+	Expired          uint32
+}
+
+// StakeDifficultyResult is the harness representation of
+// dcrjson.GetStakeDifficultyResult
+type StakeDifficultyResult struct {
+	CurrentStakeDifficulty coin.Amount
+	NextStakeDifficulty    coin.Amount
+}
+
+// EstimateStakeDiffResult is the harness representation of
+// dcrjson.EstimateStakeDiffResult
+type EstimateStakeDiffResult struct {
+	Min      coin.Amount
+	Max      coin.Amount
+	Expected coin.Amount
+	User     *coin.Amount
+}
+
+// PoolUserTicket is the harness representation of dcrjson.PoolUserTicket
+type PoolUserTicket struct {
+	Status        string
+	Ticket        string
+	TicketHeight  uint32
+	SpentBy       string
+	SpentByHeight uint32
+}
+
+// StakePoolUserInfoResult is the harness representation of
+// dcrjson.StakePoolUserInfoResult
+type StakePoolUserInfoResult struct {
+	Tickets        []PoolUserTicket
+	InvalidTickets []string
+}
+
+func (c *RPCClient) PurchaseTicket(args *PurchaseTicketArgs) (result []coinharness.Hash, err error) {
+	defer c.record("purchaseticket", args)(&result, &err)
+	var ticketAddress, poolAddress dcrutil.Address
+	if args.TicketAddress != nil {
+		ticketAddress = args.TicketAddress.Internal().(dcrutil.Address)
+	}
+	if args.PoolAddress != nil {
+		poolAddress = args.PoolAddress.Internal().(dcrutil.Address)
+	}
+	list, err := c.rpc.PurchaseTicket(
+		args.Account,
+		dcrutil.Amount(args.SpendLimit.ToAtoms()),
+		args.MinConf,
+		ticketAddress,
+		args.NumTickets,
+		poolAddress,
+		amountToLegacyPtr(args.PoolFees),
+		args.Expiry,
+		args.TicketChange,
+		amountToLegacyPtr(args.TicketFee),
+	)
+	if err != nil {
+		return nil, err
+	}
+	result = []coinharness.Hash{}
+	for _, e := range list {
+		result = append(result, e)
+	}
+	return result, nil
+}
+
+func (c *RPCClient) GetStakeInfo() (result *StakeInfoResult, err error) {
+	defer c.record("getstakeinfo")(&result, &err)
+	r, err := c.rpc.GetStakeInfo()
+	if err != nil {
+		return nil, err
+	}
+	return &StakeInfoResult{
+		BlockHeight:      r.BlockHeight,
+		Difficulty:       coin.FromFloat(r.Difficulty),
+		TotalSubsidy:     coin.FromFloat(r.TotalSubsidy),
+		OwnMempoolTix:    r.OwnMempoolTix,
+		Immature:         r.Immature,
+		Unspent:          r.Unspent,
+		Voted:            r.Voted,
+		Revoked:          r.Revoked,
+		UnspentExpired:   r.UnspentExpired,
+		PoolSize:         r.PoolSize,
+		AllMempoolTix:    r.AllMempoolTix,
+		Live:             r.Live,
+		ProportionLive:   r.ProportionLive,
+		Missed:           r.Missed,
+		ProportionMissed: r.ProportionMissed,
+		Expired:          r.Expired,
+	}, nil
+}
+
+func (c *RPCClient) GetTickets(includeImmature bool) (result []coinharness.Hash, err error) {
+	defer c.record("gettickets", includeImmature)(&result, &err)
+	list, err := c.rpc.GetTickets(includeImmature)
+	if err != nil {
+		return nil, err
+	}
+	result = []coinharness.Hash{}
+	for _, e := range list {
+		result = append(result, e)
+	}
+	return result, nil
+}
+
+// LiveTickets returns the hashes of the live tickets of the node
+func (c *RPCClient) LiveTickets() (result []coinharness.Hash, err error) {
+	defer c.record("livetickets")(&result, &err)
+	list, err := c.rpc.LiveTickets()
+	if err != nil {
+		return nil, err
+	}
+	result = []coinharness.Hash{}
+	for _, e := range list {
+		result = append(result, e)
+	}
+	return result, nil
+}
+
+// MissedTickets returns the hashes of the tickets missed on the main chain
+func (c *RPCClient) MissedTickets() (result []coinharness.Hash, err error) {
+	defer c.record("missedtickets")(&result, &err)
+	list, err := c.rpc.MissedTickets()
+	if err != nil {
+		return nil, err
+	}
+	result = []coinharness.Hash{}
+	for _, e := range list {
+		result = append(result, e)
+	}
+	return result, nil
+}
+
+func (c *RPCClient) GetStakeDifficulty() (result *StakeDifficultyResult, err error) {
+	defer c.record("getstakedifficulty")(&result, &err)
+	r, err := c.rpc.GetStakeDifficulty()
+	if err != nil {
+		return nil, err
+	}
+	return &StakeDifficultyResult{
+		CurrentStakeDifficulty: coin.FromFloat(r.CurrentStakeDifficulty),
+		NextStakeDifficulty:    coin.FromFloat(r.NextStakeDifficulty),
+	}, nil
+}
+
+// EstimateStakeDiff estimates the next stake difficulty, passing the
+// number of tickets makes the node estimate the user defined value as well
+func (c *RPCClient) EstimateStakeDiff(tickets *uint32) (result *EstimateStakeDiffResult, err error) {
+	defer c.record("estimatestakediff", tickets)(&result, &err)
+	r, err := c.rpc.EstimateStakeDiff(tickets)
+	if err != nil {
+		return nil, err
+	}
+	result = &EstimateStakeDiffResult{
+		Min:      coin.FromFloat(r.Min),
+		Max:      coin.FromFloat(r.Max),
+		Expected: coin.FromFloat(r.Expected),
+		User:     amountFromFloatPtr(r.User),
+	}
+	return result, nil
+}
+
+func (c *RPCClient) StakePoolUserInfo(address coinharness.Address) (result *StakePoolUserInfoResult, err error) {
+	defer c.record("stakepooluserinfo", address)(&result, &err)
+	r, err := c.rpc.StakePoolUserInfo(address.Internal().(dcrutil.Address))
+	if err != nil {
+		return nil, err
+	}
+	result = &StakePoolUserInfoResult{
+		InvalidTickets: r.InvalidTickets,
+	}
+	for _, t := range r.Tickets {
+		result.Tickets = append(result.Tickets, PoolUserTicket{
+			Status:        t.Status,
+			Ticket:        t.Ticket,
+			TicketHeight:  t.TicketHeight,
+			SpentBy:       t.SpentBy,
+			SpentByHeight: t.SpentByHeight,
+		})
+	}
+	return result, nil
+}
+
+func (c *RPCClient) SetTicketMaxPrice(max coin.Amount) (err error) {
+	defer c.record("setticketmaxprice", max)(nil, &err)
+	return c.rawRequest("setticketmaxprice",
+		dcrutil.Amount(max.ToAtoms()).ToCoin())
+}
+
+// Revoke makes the wallet revoke all of its missed and expired tickets
+func (c *RPCClient) Revoke() (err error) {
+	defer c.record("revoketickets")(nil, &err)
+	return c.rawRequest("revoketickets")
+}
+
+// RebroadcastMissed makes the wallet request the node to resend
+// the missed tickets notifications
+func (c *RPCClient) RebroadcastMissed() (err error) {
+	defer c.record("rebroadcastmissed")(nil, &err)
+	return c.rawRequest("rebroadcastmissed")
+}
+
+// rawRequest sends the command the rpcclient has no typed method for,
+// the result of the command is discarded
+func (c *RPCClient) rawRequest(method string, params ...interface{}) error {
+	return c.rawRequestResult(method, nil, params...)
+}
+
+// rawRequestResult sends the command the rpcclient has no typed method for
+// and unmarshals its result into the passed value unless it is nil
+func (c *RPCClient) rawRequestResult(method string, result interface{}, params ...interface{}) error {
+	raw := []json.RawMessage{}
+	for _, p := range params {
+		b, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		raw = append(raw, b)
+	}
+	r, err := c.rpc.RawRequest(method, raw)
+	if err != nil || result == nil {
+		return err
+	}
+	return json.Unmarshal(r, result)
+}
+
+func amountToLegacyPtr(a *coin.Amount) *dcrutil.Amount {
+	if a == nil {
+		return nil
+	}
+	legacy := dcrutil.Amount(a.ToAtoms())
+	return &legacy
+}
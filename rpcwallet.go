@@ -0,0 +1,175 @@
+package dcrharness
+
+import (
+	"encoding/hex"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrjson"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/wire"
+	"github.com/jfixby/coin"
+	"github.com/jfixby/coinharness"
+)
+
+// GetTransactionDetailsResult is the harness representation of
+// dcrjson.GetTransactionDetailsResult
+type GetTransactionDetailsResult struct {
+	Account           string
+	Address           string
+	Amount            coin.Amount
+	Category          string
+	InvolvesWatchOnly bool
+	Fee               *coin.Amount
+	Vout              uint32
+}
+
+// GetTransactionResult is the harness representation of
+// dcrjson.GetTransactionResult
+type GetTransactionResult struct {
+	Amount          coin.Amount
+	Fee             coin.Amount
+	Confirmations   int64
+	BlockHash       string
+	BlockIndex      int64
+	BlockTime       int64
+	TxID            string
+	WalletConflicts []string
+	Time            int64
+	TimeReceived    int64
+	Details         []GetTransactionDetailsResult
+	Tx              *coinharness.MessageTx
+}
+
+// ListTransactionsResult is the harness representation of
+// dcrjson.ListTransactionsResult
+type ListTransactionsResult struct {
+	Account           string
+	Address           string
+	Amount            coin.Amount
+	BlockHash         string
+	BlockIndex        *int64
+	BlockTime         int64
+	Category          string
+	Confirmations     int64
+	Fee               *coin.Amount
+	Generated         bool
+	InvolvesWatchOnly bool
+	Time              int64
+	TimeReceived      int64
+	TxID              string
+	TxType            *string
+	Vout              uint32
+	WalletConflicts   []string
+	Comment           string
+	OtherAccount      string
+}
+
+func (c *RPCClient) SendToAddress(address coinharness.Address, amount coin.Amount) (result coinharness.Hash, err error) {
+	defer c.record("sendtoaddress", address, amount)(&result, &err)
+	return c.rpc.SendToAddress(address.Internal().(dcrutil.Address),
+		dcrutil.Amount(amount.ToAtoms()))
+}
+
+func (c *RPCClient) SendFrom(account string, address coinharness.Address, amount coin.Amount) (result coinharness.Hash, err error) {
+	defer c.record("sendfrom", account, address, amount)(&result, &err)
+	return c.rpc.SendFrom(account, address.Internal().(dcrutil.Address),
+		dcrutil.Amount(amount.ToAtoms()))
+}
+
+func (c *RPCClient) SendMany(account string, amounts map[coinharness.Address]coin.Amount) (result coinharness.Hash, err error) {
+	defer c.record("sendmany", account, amounts)(&result, &err)
+	legacy := make(map[dcrutil.Address]dcrutil.Amount)
+	for k, v := range amounts {
+		legacy[k.Internal().(dcrutil.Address)] = dcrutil.Amount(v.ToAtoms())
+	}
+	return c.rpc.SendMany(account, legacy)
+}
+
+func (c *RPCClient) GetTransaction(hash coinharness.Hash) (result *GetTransactionResult, err error) {
+	defer c.record("gettransaction", hash)(&result, &err)
+	legacy, err := c.rpc.GetTransaction(hash.(*chainhash.Hash))
+	if err != nil {
+		return nil, err
+	}
+	result = &GetTransactionResult{
+		Amount:          coin.FromFloat(legacy.Amount),
+		Fee:             coin.FromFloat(legacy.Fee),
+		Confirmations:   legacy.Confirmations,
+		BlockHash:       legacy.BlockHash,
+		BlockIndex:      legacy.BlockIndex,
+		BlockTime:       legacy.BlockTime,
+		TxID:            legacy.TxID,
+		WalletConflicts: legacy.WalletConflicts,
+		Time:            legacy.Time,
+		TimeReceived:    legacy.TimeReceived,
+	}
+	for _, d := range legacy.Details {
+		result.Details = append(result.Details, GetTransactionDetailsResult{
+			Account:           d.Account,
+			Address:           d.Address,
+			Amount:            coin.FromFloat(d.Amount),
+			Category:          d.Category,
+			InvolvesWatchOnly: d.InvolvesWatchOnly,
+			Fee:               amountFromFloatPtr(d.Fee),
+			Vout:              d.Vout,
+		})
+	}
+
+	txBytes, err := hex.DecodeString(legacy.Hex)
+	if err != nil {
+		return nil, err
+	}
+	tx := &wire.MsgTx{}
+	if err := tx.FromBytes(txBytes); err != nil {
+		return nil, err
+	}
+	result.Tx = TransactionRawToTx(tx)
+
+	return result, nil
+}
+
+// ListTransactions returns up to count most recent transactions of
+// the account skipping the first from transactions
+func (c *RPCClient) ListTransactions(account string, count int, from int) (result []*ListTransactionsResult, err error) {
+	defer c.record("listtransactions", account, count, from)(&result, &err)
+	list, err := c.rpc.ListTransactionsCountFrom(account, count, from)
+	if err != nil {
+		return nil, err
+	}
+	r := []*ListTransactionsResult{}
+	for _, e := range list {
+		r = append(r, convertListTransactionsResult(&e))
+	}
+	return r, nil
+}
+
+func convertListTransactionsResult(e *dcrjson.ListTransactionsResult) *ListTransactionsResult {
+	return &ListTransactionsResult{
+		Account:           e.Account,
+		Address:           e.Address,
+		Amount:            coin.FromFloat(e.Amount),
+		BlockHash:         e.BlockHash,
+		BlockIndex:        e.BlockIndex,
+		BlockTime:         e.BlockTime,
+		Category:          e.Category,
+		Confirmations:     e.Confirmations,
+		Fee:               amountFromFloatPtr(e.Fee),
+		Generated:         e.Generated,
+		InvolvesWatchOnly: e.InvolvesWatchOnly,
+		Time:              e.Time,
+		TimeReceived:      e.TimeReceived,
+		TxID:              e.TxID,
+		TxType:            e.TxType,
+		Vout:              e.Vout,
+		WalletConflicts:   e.WalletConflicts,
+		Comment:           e.Comment,
+		OtherAccount:      e.OtherAccount,
+	}
+}
+
+func amountFromFloatPtr(f *float64) *coin.Amount {
+	if f == nil {
+		return nil
+	}
+	a := coin.FromFloat(*f)
+	return &a
+}
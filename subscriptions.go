@@ -0,0 +1,434 @@
+package dcrharness
+
+import (
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrjson"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/rpcclient"
+	"github.com/decred/dcrd/wire"
+	"github.com/jfixby/coin"
+	"github.com/jfixby/coinharness"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultSubscriptionBuffer is the size of the subscription channel
+// used when SubscribeArgs.BufferSize is not set
+const DefaultSubscriptionBuffer = 256
+
+// EventKind identifies the type of the notification event
+type EventKind int
+
+const (
+	BlockConnectedEventKind EventKind = iota
+	BlockDisconnectedEventKind
+	WinningTicketsEventKind
+	NewTicketsEventKind
+	StakeDifficultyEventKind
+	TxAcceptedEventKind
+	TxAcceptedVerboseEventKind
+	RelevantTxEventKind
+)
+
+// Event is the notification delivered to subscribers, it is one of
+// the *Event types of this file
+type Event interface {
+	Kind() EventKind
+}
+
+// BlockConnectedEvent reports the block attached to the main chain.
+// Transactions are the ones matching the loaded tx filter.
+type BlockConnectedEvent struct {
+	Header       MsgBlockHeader
+	Transactions []*coinharness.MessageTx
+}
+
+func (e *BlockConnectedEvent) Kind() EventKind {
+	return BlockConnectedEventKind
+}
+
+// BlockDisconnectedEvent reports the block removed from the main chain
+type BlockDisconnectedEvent struct {
+	Header MsgBlockHeader
+}
+
+func (e *BlockDisconnectedEvent) Kind() EventKind {
+	return BlockDisconnectedEventKind
+}
+
+// WinningTicketsEvent reports the tickets selected to vote on the block
+type WinningTicketsEvent struct {
+	BlockHash   *chainhash.Hash
+	BlockHeight int64
+	Tickets     []*chainhash.Hash
+}
+
+func (e *WinningTicketsEvent) Kind() EventKind {
+	return WinningTicketsEventKind
+}
+
+// NewTicketsEvent reports the tickets purchased in the block
+type NewTicketsEvent struct {
+	BlockHash   *chainhash.Hash
+	BlockHeight int64
+	StakeDiff   int64
+	Tickets     []*chainhash.Hash
+}
+
+func (e *NewTicketsEvent) Kind() EventKind {
+	return NewTicketsEventKind
+}
+
+// StakeDifficultyEvent reports the stake difficulty of the next block
+type StakeDifficultyEvent struct {
+	BlockHash   *chainhash.Hash
+	BlockHeight int64
+	StakeDiff   int64
+}
+
+func (e *StakeDifficultyEvent) Kind() EventKind {
+	return StakeDifficultyEventKind
+}
+
+// TxAcceptedEvent reports the transaction accepted to the mempool
+type TxAcceptedEvent struct {
+	Hash   *chainhash.Hash
+	Amount coin.Amount
+}
+
+func (e *TxAcceptedEvent) Kind() EventKind {
+	return TxAcceptedEventKind
+}
+
+// TxAcceptedVerboseEvent reports the transaction accepted to the mempool
+// when verbose notifications are requested
+type TxAcceptedVerboseEvent struct {
+	*TxAcceptedVerbose
+}
+
+func (e *TxAcceptedVerboseEvent) Kind() EventKind {
+	return TxAcceptedVerboseEventKind
+}
+
+// RelevantTxEvent reports the mempool transaction matching
+// the loaded tx filter
+type RelevantTxEvent struct {
+	Tx *coinharness.MessageTx
+}
+
+func (e *RelevantTxEvent) Kind() EventKind {
+	return RelevantTxEventKind
+}
+
+// SubscribeArgs bundles Subscribe() arguments. Empty Kinds stands for
+// all kinds, nil Filter accepts every event of the requested kinds.
+type SubscribeArgs struct {
+	Kinds      []EventKind
+	Filter     func(e Event) bool
+	BufferSize int
+}
+
+// Subscription delivers events on the Events channel. Events are dropped
+// rather than block the client when the channel is full, see Dropped().
+// The channel is closed on Unsubscribe() and when the client disconnects.
+type Subscription struct {
+	// dropped is accessed atomically and kept first for 64-bit alignment
+	dropped uint64
+
+	Events <-chan Event
+
+	events   chan Event
+	kinds    map[EventKind]bool
+	filter   func(e Event) bool
+	notifier *notifier
+}
+
+// Dropped returns the number of events lost due to the full channel
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Unsubscribe stops the delivery and closes the Events channel,
+// it is safe to call it more than once
+func (s *Subscription) Unsubscribe() {
+	s.notifier.unsubscribe(s)
+}
+
+func (s *Subscription) accepts(e Event) bool {
+	if len(s.kinds) > 0 && !s.kinds[e.Kind()] {
+		return false
+	}
+	return s.filter == nil || s.filter(e)
+}
+
+// Subscribe registers a new subscriber. The node only sends notifications
+// the client is registered for, e.g. by NotifyBlocks().
+func (c *RPCClient) Subscribe(args *SubscribeArgs) *Subscription {
+	return c.notifier.subscribe(args)
+}
+
+// DroppedNotifications returns the number of notifications the client
+// dropped because they failed to decode
+func (c *RPCClient) DroppedNotifications() uint64 {
+	return c.notifier.dropped()
+}
+
+// notifier fans the rpcclient notifications out to the subscribers
+// and tracks the notifications the client is registered for
+type notifier struct {
+	// malformed is accessed atomically and kept first for 64-bit alignment
+	malformed uint64
+
+	mtx         sync.RWMutex
+	subscribers map[*Subscription]struct{}
+	registered  map[EventKind]bool
+	closed      bool
+}
+
+func newNotifier() *notifier {
+	return &notifier{
+		subscribers: make(map[*Subscription]struct{}),
+		registered:  make(map[EventKind]bool),
+	}
+}
+
+func (n *notifier) register(kinds ...EventKind) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	for _, k := range kinds {
+		n.registered[k] = true
+	}
+}
+
+func (n *notifier) unregister(kinds ...EventKind) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	for _, k := range kinds {
+		delete(n.registered, k)
+	}
+}
+
+// isRegistered reports whether any of the kinds is delivered by the node
+func (n *notifier) isRegistered(kinds []EventKind) bool {
+	n.mtx.RLock()
+	defer n.mtx.RUnlock()
+	if n.closed {
+		return false
+	}
+	for _, k := range kinds {
+		if n.registered[k] {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *notifier) subscribe(args *SubscribeArgs) *Subscription {
+	if args == nil {
+		args = &SubscribeArgs{}
+	}
+	size := args.BufferSize
+	if size <= 0 {
+		size = DefaultSubscriptionBuffer
+	}
+	events := make(chan Event, size)
+	s := &Subscription{
+		Events:   events,
+		events:   events,
+		kinds:    make(map[EventKind]bool),
+		filter:   args.Filter,
+		notifier: n,
+	}
+	for _, k := range args.Kinds {
+		s.kinds[k] = true
+	}
+
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	if n.closed {
+		close(events)
+		return s
+	}
+	n.subscribers[s] = struct{}{}
+	return s
+}
+
+func (n *notifier) unsubscribe(s *Subscription) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	if _, ok := n.subscribers[s]; !ok {
+		return
+	}
+	delete(n.subscribers, s)
+	close(s.events)
+}
+
+// close unsubscribes everybody, later subscriptions are closed right away
+func (n *notifier) close() {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	for s := range n.subscribers {
+		close(s.events)
+	}
+	n.subscribers = make(map[*Subscription]struct{})
+	n.closed = true
+}
+
+func (n *notifier) publish(e Event) {
+	n.mtx.RLock()
+	defer n.mtx.RUnlock()
+	for s := range n.subscribers {
+		if !s.accepts(e) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+// dropMalformed counts the notification that failed to decode, the
+// notification is not delivered as the rpcclient goroutine calling
+// the handlers must not panic
+func (n *notifier) dropMalformed() {
+	atomic.AddUint64(&n.malformed, 1)
+}
+
+// dropped returns the number of notifications that failed to decode
+func (n *notifier) dropped() uint64 {
+	return atomic.LoadUint64(&n.malformed)
+}
+
+// chain returns a copy of the handlers publishing the events
+// after the original callbacks are called. The verbose tx-accepted
+// payload is converted once and passed to onTxAcceptedVerbose
+// unless it is nil.
+func (n *notifier) chain(handlers *rpcclient.NotificationHandlers, onTxAcceptedVerbose func(tx *TxAcceptedVerbose)) *rpcclient.NotificationHandlers {
+	h := &rpcclient.NotificationHandlers{}
+	if handlers != nil {
+		*h = *handlers
+	}
+	onBlockConnected := h.OnBlockConnected
+	h.OnBlockConnected = func(blockHeader []byte, transactions [][]byte) {
+		if onBlockConnected != nil {
+			onBlockConnected(blockHeader, transactions)
+		}
+		header, err := eventHeader(blockHeader)
+		if err != nil {
+			n.dropMalformed()
+			return
+		}
+		e := &BlockConnectedEvent{Header: header}
+		for _, txBytes := range transactions {
+			tx, err := eventTx(txBytes)
+			if err != nil {
+				n.dropMalformed()
+				return
+			}
+			e.Transactions = append(e.Transactions, tx)
+		}
+		n.publish(e)
+	}
+	onBlockDisconnected := h.OnBlockDisconnected
+	h.OnBlockDisconnected = func(blockHeader []byte) {
+		if onBlockDisconnected != nil {
+			onBlockDisconnected(blockHeader)
+		}
+		header, err := eventHeader(blockHeader)
+		if err != nil {
+			n.dropMalformed()
+			return
+		}
+		n.publish(&BlockDisconnectedEvent{Header: header})
+	}
+	onWinningTickets := h.OnWinningTickets
+	h.OnWinningTickets = func(blockHash *chainhash.Hash, blockHeight int64, tickets []*chainhash.Hash) {
+		if onWinningTickets != nil {
+			onWinningTickets(blockHash, blockHeight, tickets)
+		}
+		n.publish(&WinningTicketsEvent{
+			BlockHash:   blockHash,
+			BlockHeight: blockHeight,
+			Tickets:     tickets,
+		})
+	}
+	onNewTickets := h.OnNewTickets
+	h.OnNewTickets = func(hash *chainhash.Hash, height int64, stakeDiff int64, tickets []*chainhash.Hash) {
+		if onNewTickets != nil {
+			onNewTickets(hash, height, stakeDiff, tickets)
+		}
+		n.publish(&NewTicketsEvent{
+			BlockHash:   hash,
+			BlockHeight: height,
+			StakeDiff:   stakeDiff,
+			Tickets:     tickets,
+		})
+	}
+	onStakeDifficulty := h.OnStakeDifficulty
+	h.OnStakeDifficulty = func(hash *chainhash.Hash, height int64, stakeDiff int64) {
+		if onStakeDifficulty != nil {
+			onStakeDifficulty(hash, height, stakeDiff)
+		}
+		n.publish(&StakeDifficultyEvent{
+			BlockHash:   hash,
+			BlockHeight: height,
+			StakeDiff:   stakeDiff,
+		})
+	}
+	onTxAccepted := h.OnTxAccepted
+	h.OnTxAccepted = func(hash *chainhash.Hash, amount dcrutil.Amount) {
+		if onTxAccepted != nil {
+			onTxAccepted(hash, amount)
+		}
+		n.publish(&TxAcceptedEvent{
+			Hash:   hash,
+			Amount: coin.Amount{int64(amount)},
+		})
+	}
+	onTxAcceptedVerboseRaw := h.OnTxAcceptedVerbose
+	h.OnTxAcceptedVerbose = func(txDetails *dcrjson.TxRawResult) {
+		if onTxAcceptedVerboseRaw != nil {
+			onTxAcceptedVerboseRaw(txDetails)
+		}
+		tx, err := NewTxAcceptedVerbose(txDetails)
+		if err != nil {
+			n.dropMalformed()
+			return
+		}
+		if onTxAcceptedVerbose != nil {
+			onTxAcceptedVerbose(tx)
+		}
+		n.publish(&TxAcceptedVerboseEvent{tx})
+	}
+	onRelevantTxAccepted := h.OnRelevantTxAccepted
+	h.OnRelevantTxAccepted = func(transaction []byte) {
+		if onRelevantTxAccepted != nil {
+			onRelevantTxAccepted(transaction)
+		}
+		tx, err := eventTx(transaction)
+		if err != nil {
+			n.dropMalformed()
+			return
+		}
+		n.publish(&RelevantTxEvent{Tx: tx})
+	}
+	return h
+}
+
+func eventHeader(headerBytes []byte) (MsgBlockHeader, error) {
+	var header wire.BlockHeader
+	if err := header.FromBytes(headerBytes); err != nil {
+		return MsgBlockHeader{}, err
+	}
+	return BlockHeaderRawToHeader(&header), nil
+}
+
+func eventTx(txBytes []byte) (*coinharness.MessageTx, error) {
+	tx := &wire.MsgTx{}
+	if err := tx.FromBytes(txBytes); err != nil {
+		return nil, err
+	}
+	return TransactionRawToTx(tx), nil
+}
@@ -0,0 +1,125 @@
+package dcrharness
+
+import (
+	"testing"
+)
+
+func TestNotifierSubscribe(t *testing.T) {
+	n := newNotifier()
+	all := n.subscribe(nil)
+	blocks := n.subscribe(&SubscribeArgs{
+		Kinds: []EventKind{BlockConnectedEventKind},
+	})
+	filtered := n.subscribe(&SubscribeArgs{
+		Filter: func(e Event) bool {
+			_, ok := e.(*TxAcceptedEvent)
+			return ok
+		},
+	})
+	small := n.subscribe(&SubscribeArgs{BufferSize: 1})
+
+	n.publish(&BlockConnectedEvent{})
+	n.publish(&TxAcceptedEvent{})
+
+	tests := []struct {
+		name     string
+		s        *Subscription
+		expected []EventKind
+		dropped  uint64
+	}{
+		{
+			name:     "all kinds",
+			s:        all,
+			expected: []EventKind{BlockConnectedEventKind, TxAcceptedEventKind},
+		},
+		{
+			name:     "kinds",
+			s:        blocks,
+			expected: []EventKind{BlockConnectedEventKind},
+		},
+		{
+			name:     "filter",
+			s:        filtered,
+			expected: []EventKind{TxAcceptedEventKind},
+		},
+		{
+			name:     "full buffer",
+			s:        small,
+			expected: []EventKind{BlockConnectedEventKind},
+			dropped:  1,
+		},
+	}
+
+	for _, test := range tests {
+		test.s.Unsubscribe()
+		got := []EventKind{}
+		for e := range test.s.Events {
+			got = append(got, e.Kind())
+		}
+		if len(got) != len(test.expected) {
+			t.Errorf("%v: got events %v, want %v", test.name, got,
+				test.expected)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.expected[i] {
+				t.Errorf("%v: got events %v, want %v", test.name, got,
+					test.expected)
+				break
+			}
+		}
+		if test.s.Dropped() != test.dropped {
+			t.Errorf("%v: got %v dropped events, want %v", test.name,
+				test.s.Dropped(), test.dropped)
+		}
+		// a second call is a no-op
+		test.s.Unsubscribe()
+	}
+}
+
+func TestNotifierClose(t *testing.T) {
+	n := newNotifier()
+	n.register(BlockConnectedEventKind)
+	if !n.isRegistered([]EventKind{TxAcceptedEventKind, BlockConnectedEventKind}) {
+		t.Errorf("registered kind is not reported")
+	}
+	n.unregister(BlockConnectedEventKind)
+	if n.isRegistered([]EventKind{BlockConnectedEventKind}) {
+		t.Errorf("unregistered kind is reported")
+	}
+	n.register(BlockConnectedEventKind)
+
+	s := n.subscribe(nil)
+	n.close()
+	if _, ok := <-s.Events; ok {
+		t.Errorf("subscription is not closed by the notifier")
+	}
+	s.Unsubscribe()
+
+	late := n.subscribe(nil)
+	n.publish(&BlockConnectedEvent{})
+	if _, ok := <-late.Events; ok {
+		t.Errorf("subscription made after close is open")
+	}
+	if n.isRegistered([]EventKind{BlockConnectedEventKind}) {
+		t.Errorf("closed notifier reports registered kinds")
+	}
+}
+
+func TestNotifierDropsMalformed(t *testing.T) {
+	n := newNotifier()
+	s := n.subscribe(nil)
+	h := n.chain(nil, nil)
+
+	h.OnBlockConnected([]byte{0x01}, nil)
+	h.OnBlockDisconnected([]byte{0x01})
+	h.OnRelevantTxAccepted([]byte{0x01})
+
+	s.Unsubscribe()
+	for e := range s.Events {
+		t.Errorf("malformed notification delivered as %T", e)
+	}
+	if n.dropped() != 3 {
+		t.Errorf("got %v dropped notifications, want 3", n.dropped())
+	}
+}
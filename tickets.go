@@ -0,0 +1,298 @@
+package dcrharness
+
+import (
+	"fmt"
+	"github.com/decred/dcrd/blockchain/stake"
+	"github.com/decred/dcrd/chaincfg"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrec/secp256k1"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/txscript"
+	"github.com/decred/dcrd/wire"
+	"github.com/jfixby/coinharness"
+	"sort"
+)
+
+// DefaultTicketFeeLimits are the fee limits of the ticket commitment output,
+// no fees are allowed for votes and up to 2^24 atoms are allowed for
+// revocations. This is the value used by dcrwallet.
+const DefaultTicketFeeLimits uint16 = 0x5800
+
+// DefaultTicketFeeRate is the fee rate per kB paid by ticket purchases
+// when none is specified
+const DefaultTicketFeeRate dcrutil.Amount = 1e4
+
+// TicketInput is an output spent by a ticket purchase
+type TicketInput struct {
+	OutPoint wire.OutPoint
+	Amount   int64
+	PkScript []byte
+	Key      *secp256k1.PrivateKey
+}
+
+// TicketArgs describes the ticket NewTicket() and PurchaseTicket() buy
+type TicketArgs struct {
+	// TicketPrice is the stake difficulty the ticket is bought at
+	TicketPrice int64
+	// VotingAddress receives the ticket's stake output
+	VotingAddress dcrutil.Address
+	// RewardAddress is committed to receive vote rewards or revocation refunds
+	RewardAddress dcrutil.Address
+	// ChangeAddress receives the change of every input
+	ChangeAddress dcrutil.Address
+	// FeeRate is the fee per kB paid by the ticket,
+	// zero stands for DefaultTicketFeeRate
+	FeeRate dcrutil.Amount
+	// FeeLimits are the fee limits of the commitment outputs,
+	// zero stands for DefaultTicketFeeLimits
+	FeeLimits uint16
+	// Expiry is the height the ticket expires from the mempool at,
+	// zero stands for no expiry
+	Expiry  uint32
+	Network *chaincfg.Params
+}
+
+// NewTicket creates a signed SStx ticket purchase spending the inputs.
+// The ticket has the OP_SSTX stake output paying the ticket price to the
+// voting address followed by a commitment and a change output per input,
+// as required by consensus rules.
+func NewTicket(inputs []*TicketInput, args *TicketArgs) (*wire.MsgTx, error) {
+	feeRate := args.FeeRate
+	if feeRate == 0 {
+		feeRate = DefaultTicketFeeRate
+	}
+
+	// The fee depends on the size of the signed ticket, build it twice
+	// when the first estimate turns out to be too low.
+	fee := int64(0)
+	for {
+		tx, err := buildTicket(inputs, args, fee)
+		if err != nil {
+			return nil, err
+		}
+		required := int64(feeRate) * int64(tx.SerializeSize()) / 1000
+		if fee >= required {
+			return tx, nil
+		}
+		fee = required
+	}
+}
+
+func buildTicket(inputs []*TicketInput, args *TicketArgs, fee int64) (*wire.MsgTx, error) {
+	limits := args.FeeLimits
+	if limits == 0 {
+		limits = DefaultTicketFeeLimits
+	}
+
+	tx := wire.NewMsgTx()
+	tx.Expiry = args.Expiry
+
+	stakeScript, err := txscript.PayToSStx(args.VotingAddress)
+	if err != nil {
+		return nil, err
+	}
+	tx.AddTxOut(wire.NewTxOut(args.TicketPrice, stakeScript))
+
+	changeScript, err := txscript.PayToSStxChange(args.ChangeAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every input contributes until the ticket price and the fee are
+	// covered, the rest of it is returned as change.
+	remaining := args.TicketPrice + fee
+	for _, in := range inputs {
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: in.OutPoint,
+			Sequence:         wire.MaxTxInSequenceNum,
+			ValueIn:          in.Amount,
+			BlockHeight:      wire.NullBlockHeight,
+			BlockIndex:       wire.NullBlockIndex,
+		})
+
+		contribution := in.Amount
+		if contribution > remaining {
+			contribution = remaining
+		}
+		remaining -= contribution
+
+		commitScript, err := txscript.GenerateSStxAddrPush(
+			args.RewardAddress, dcrutil.Amount(contribution), limits)
+		if err != nil {
+			return nil, err
+		}
+		tx.AddTxOut(wire.NewTxOut(0, commitScript))
+		tx.AddTxOut(wire.NewTxOut(in.Amount-contribution, changeScript))
+	}
+	if remaining > 0 {
+		return nil, fmt.Errorf("insufficient funds: ticket price %v "+
+			"and fee %v exceed inputs by %v",
+			dcrutil.Amount(args.TicketPrice), dcrutil.Amount(fee),
+			dcrutil.Amount(remaining))
+	}
+
+	for i, in := range inputs {
+		sigScript, err := txscript.SignatureScript(tx, i, in.PkScript,
+			txscript.SigHashAll, in.Key, true)
+		if err != nil {
+			return nil, err
+		}
+		tx.TxIn[i].SignatureScript = sigScript
+	}
+	return tx, nil
+}
+
+// ticketBaseSize and ticketInputSize estimate the size of a ticket: the
+// fixed part with the stake output and the part added by every input with
+// its signature script, commitment and change outputs
+const (
+	ticketBaseSize  = 60
+	ticketInputSize = 250
+)
+
+// PurchaseTicket buys a ticket funded by the InMemoryWallet UTXOs and submits
+// it to the node. The ticket pays the stake difficulty of the next block, the
+// one the mempool checks tickets against. Addresses left empty in
+// the args default to the wallet coinbase address. The spent UTXOs are locked
+// until the wallet releases them once the ticket gets mined.
+//
+// The change of the ticket is paid to OP_SSTXCHANGE outputs the InMemoryWallet
+// neither tracks nor spends, so it is lost to the wallet. Inputs are picked
+// largest first to keep the number of change outputs low, pass the address
+// of a wallet able to spend stake change as ChangeAddress to recover it.
+func PurchaseTicket(wallet *coinharness.InMemoryWallet, client coinharness.RPCClient, args *TicketArgs) (coinharness.Hash, error) {
+	net := wallet.Net.Params().(*chaincfg.Params)
+	c, err := harnessClient(client)
+	if err != nil {
+		return nil, err
+	}
+	stakeDiff, err := c.GetStakeDifficulty()
+	if err != nil {
+		return nil, err
+	}
+	_, height, err := c.GetBestBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	a := *args
+	a.TicketPrice = stakeDiff.NextStakeDifficulty.ToAtoms()
+	a.Network = net
+	if a.FeeRate == 0 {
+		a.FeeRate = DefaultTicketFeeRate
+	}
+	coinbaseAddr := wallet.CoinbaseAddr.Internal().(dcrutil.Address)
+	if a.VotingAddress == nil {
+		a.VotingAddress = coinbaseAddr
+	}
+	if a.RewardAddress == nil {
+		a.RewardAddress = coinbaseAddr
+	}
+	if a.ChangeAddress == nil {
+		a.ChangeAddress = coinbaseAddr
+	}
+
+	inputs, outPoints, err := selectTicketInputs(wallet, height, a.TicketPrice, a.FeeRate)
+	if err != nil {
+		return nil, err
+	}
+	ticket, err := NewTicket(inputs, &a)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lock the inputs so that the next purchase does not double-spend
+	// them, they are released when the ticket is rejected.
+	setUtxosLocked(wallet, outPoints, true)
+	hash, err := client.SendRawTransaction(TransactionRawToTx(ticket), false)
+	if err != nil {
+		setUtxosLocked(wallet, outPoints, false)
+		return nil, err
+	}
+	return hash, nil
+}
+
+func setUtxosLocked(wallet *coinharness.InMemoryWallet, outPoints []coinharness.OutPoint, locked bool) {
+	for _, op := range outPoints {
+		if utxo, ok := wallet.Utxos[op]; ok {
+			utxo.IsLocked = locked
+		}
+	}
+}
+
+// estimateTicketFee returns the fee of the ticket with the given number
+// of inputs at the fee rate
+func estimateTicketFee(inputs int, feeRate dcrutil.Amount) int64 {
+	size := ticketBaseSize + ticketInputSize*inputs
+	return int64(feeRate) * int64(size) / 1000
+}
+
+// selectTicketInputs picks unlocked mature wallet UTXOs, largest first,
+// until their total covers the ticket price and the estimated fee. The
+// outpoints of the picked UTXOs are returned along with the inputs.
+func selectTicketInputs(wallet *coinharness.InMemoryWallet, height int64, price int64, feeRate dcrutil.Amount) ([]*TicketInput, []coinharness.OutPoint, error) {
+	net := wallet.Net.Params().(*chaincfg.Params)
+
+	type candidate struct {
+		input *TicketInput
+		op    coinharness.OutPoint
+	}
+	candidates := []*candidate{}
+	for op, utxo := range wallet.Utxos {
+		if utxo.IsLocked || utxo.MaturityHeight > height {
+			continue
+		}
+		key, err := WalletPrivateKey(wallet, utxo.KeyIndex)
+		if err != nil {
+			return nil, nil, err
+		}
+		addr, err := keyToAddr(key, net)
+		if err != nil {
+			return nil, nil, err
+		}
+		pkScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			return nil, nil, err
+		}
+		candidates = append(candidates, &candidate{
+			input: &TicketInput{
+				OutPoint: wire.OutPoint{
+					Hash:  op.Hash.(chainhash.Hash),
+					Index: op.Index,
+					Tree:  op.Tree,
+				},
+				Amount:   utxo.Value.ToAtoms(),
+				PkScript: pkScript,
+				Key:      key,
+			},
+			op: op,
+		})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].input.Amount > candidates[j].input.Amount
+	})
+
+	selected := []*TicketInput{}
+	outPoints := []coinharness.OutPoint{}
+	total := int64(0)
+	for _, c := range candidates {
+		if total >= price+estimateTicketFee(len(selected), feeRate) {
+			break
+		}
+		if len(selected) == stake.MaxInputsPerSStx {
+			return nil, nil, fmt.Errorf("ticket price %v requires more "+
+				"than %v inputs", dcrutil.Amount(price),
+				stake.MaxInputsPerSStx)
+		}
+		selected = append(selected, c.input)
+		outPoints = append(outPoints, c.op)
+		total += c.input.Amount
+	}
+	required := price + estimateTicketFee(len(selected), feeRate)
+	if total < required {
+		return nil, nil, fmt.Errorf("insufficient funds: %v available, "+
+			"ticket price and fee are %v", dcrutil.Amount(total),
+			dcrutil.Amount(required))
+	}
+	return selected, outPoints, nil
+}
@@ -0,0 +1,88 @@
+package dcrharness
+
+import (
+	"fmt"
+	"github.com/jfixby/coinharness"
+)
+
+// Names of the components reported by the version RPC
+const (
+	NodeComponent         = "dcrd"
+	NodeRPCAPIComponent   = "dcrdjsonrpcapi"
+	WalletComponent       = "dcrwallet"
+	WalletRPCAPIComponent = "dcrwalletjsonrpcapi"
+)
+
+// SemVer is the semantic version of a component
+type SemVer struct {
+	VersionString string
+	Major         uint32
+	Minor         uint32
+	Patch         uint32
+	Prerelease    string
+	BuildMetadata string
+}
+
+// AtLeast reports whether the version is the given one or newer,
+// pre-release and build metadata are ignored
+func (v *SemVer) AtLeast(major, minor, patch uint32) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+	if v.Minor != minor {
+		return v.Minor > minor
+	}
+	return v.Patch >= patch
+}
+
+func (v *SemVer) String() string {
+	return v.VersionString
+}
+
+// BuildVersion holds versions of the components of the RPC server
+// as reported by the version RPC
+type BuildVersion struct {
+	Components map[string]*SemVer
+}
+
+// Component returns the version of the component with the given name
+func (v *BuildVersion) Component(name string) (*SemVer, error) {
+	ver, ok := v.Components[name]
+	if !ok {
+		return nil, fmt.Errorf("version of %v is not reported", name)
+	}
+	return ver, nil
+}
+
+// VersionAtLeast reports whether the component of the RPC server the client
+// is connected to is of the given version or newer. Tests use it to skip or
+// adapt to the binary launched by the harness.
+func VersionAtLeast(client coinharness.RPCClient, component string, major, minor, patch uint32) (bool, error) {
+	v, err := client.GetBuildVersion()
+	if err != nil {
+		return false, err
+	}
+	build, ok := v.(*BuildVersion)
+	if !ok {
+		return false, fmt.Errorf("unexpected build version type %T", v)
+	}
+	ver, err := build.Component(component)
+	if err != nil {
+		return false, err
+	}
+	return ver.AtLeast(major, minor, patch), nil
+}
+
+// RequireVersion returns an error unless the component of the RPC server
+// the client is connected to is of the given version or newer
+func RequireVersion(client coinharness.RPCClient, component string, major, minor, patch uint32) error {
+	ok, err := VersionAtLeast(client, component, major, minor, patch)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%v version %v.%v.%v or newer is required",
+			component, major, minor, patch)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package dcrharness
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/decred/dcrd/blockchain"
+	"github.com/decred/dcrd/blockchain/stake"
+	"github.com/decred/dcrd/chaincfg"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/txscript"
+	"github.com/decred/dcrd/wire"
+	"github.com/jfixby/coinharness"
+	"sync"
+)
+
+// VoteArgs describes the votes NewVotes() casts on a block
+type VoteArgs struct {
+	// BlockHash and BlockHeight identify the block being voted on
+	BlockHash   *chainhash.Hash
+	BlockHeight int64
+	// Tickets are the winning tickets of the block as reported
+	// by the OnWinningTickets notification
+	Tickets []*chainhash.Hash
+	// Keys hold the voting keys of the harness, tickets
+	// not controlled by the Keys are skipped
+	Keys *KeyStore
+	// VoteBits are the vote bits of every vote, the block-valid bit
+	// approves the regular tree of the voted block
+	VoteBits uint16
+	// VoteVersion is the stake version the votes are cast with
+	VoteVersion uint32
+	Network     *chaincfg.Params
+}
+
+// NewVotes creates signed SSGen transactions for every winning ticket of the
+// block controlled by the harness keys. The votes are meant to be passed to
+// CreateBlock as a part of the stake tree of the next block.
+func NewVotes(client coinharness.RPCClient, args *VoteArgs) ([]*dcrutil.Tx, error) {
+	votes := []*dcrutil.Tx{}
+	for _, ticketHash := range args.Tickets {
+		ticket, err := fetchTicket(client, ticketHash)
+		if err != nil {
+			return nil, err
+		}
+		addr, err := ticketVotingAddress(ticket, args.Network)
+		if err != nil {
+			return nil, err
+		}
+		if !args.Keys.HasKey(addr) {
+			continue
+		}
+		vote, err := NewVote(ticket, args)
+		if err != nil {
+			return nil, err
+		}
+		votes = append(votes, vote)
+	}
+	return votes, nil
+}
+
+// NewVote creates a signed SSGen transaction spending the given ticket.
+// The vote consists of the stakebase input, the ticket input, the block
+// reference output, the vote bits output and one reward output for every
+// commitment of the ticket.
+func NewVote(ticket *wire.MsgTx, args *VoteArgs) (*dcrutil.Tx, error) {
+	net := args.Network
+	// Vote subsidy aligns with the height of the block being voted on.
+	subsidyCache := blockchain.NewSubsidyCache(0, net)
+	voteSubsidy := blockchain.CalcStakeVoteSubsidy(subsidyCache,
+		args.BlockHeight, net)
+	ticketPrice := ticket.TxOut[0].Value
+
+	tx := wire.NewMsgTx()
+	tx.AddTxIn(&wire.TxIn{
+		// Stakebase input has no previous outpoint, same as coinbase.
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex, wire.TxTreeRegular),
+		Sequence:        wire.MaxTxInSequenceNum,
+		ValueIn:         voteSubsidy,
+		BlockHeight:     wire.NullBlockHeight,
+		BlockIndex:      wire.NullBlockIndex,
+		SignatureScript: net.StakeBaseSigScript,
+	})
+	ticketHash := ticket.TxHash()
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&ticketHash, 0,
+			wire.TxTreeStake),
+		Sequence:    wire.MaxTxInSequenceNum,
+		ValueIn:     ticketPrice,
+		BlockHeight: wire.NullBlockHeight,
+		BlockIndex:  wire.NullBlockIndex,
+	})
+
+	// Block reference.
+	blockRefScript, err := txscript.GenerateSSGenBlockRef(*args.BlockHash,
+		uint32(args.BlockHeight))
+	if err != nil {
+		return nil, err
+	}
+	tx.AddTxOut(wire.NewTxOut(0, blockRefScript))
+
+	// Vote bits followed by the vote version.
+	voteData := make([]byte, 6)
+	binary.LittleEndian.PutUint16(voteData[0:2], args.VoteBits)
+	binary.LittleEndian.PutUint32(voteData[2:6], args.VoteVersion)
+	voteScript, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_RETURN).AddData(voteData).Script()
+	if err != nil {
+		return nil, err
+	}
+	tx.AddTxOut(wire.NewTxOut(0, voteScript))
+
+	// Rewards.
+	commitments, err := ticketCommitments(ticket, net)
+	if err != nil {
+		return nil, err
+	}
+	amounts := make([]int64, len(commitments))
+	for i, c := range commitments {
+		amounts[i] = c.amount
+	}
+	rewards := stake.CalculateRewards(amounts, ticketPrice, voteSubsidy)
+	for i, c := range commitments {
+		pkScript, err := txscript.PayToSSGen(c.addr)
+		if err != nil {
+			return nil, err
+		}
+		tx.AddTxOut(wire.NewTxOut(rewards[i], pkScript))
+	}
+
+	if err := signTicketInput(tx, 1, ticket, args.Keys, net); err != nil {
+		return nil, err
+	}
+	return dcrutil.NewTx(tx), nil
+}
+
+// ticketCommitment is a reward commitment of a ticket purchase
+type ticketCommitment struct {
+	addr   dcrutil.Address
+	amount int64
+}
+
+// ticketCommitments extracts the reward commitments of the ticket
+func ticketCommitments(ticket *wire.MsgTx, net *chaincfg.Params) ([]*ticketCommitment, error) {
+	_, _, amounts, _, _, _ := stake.TxSStxStakeOutputInfo(ticket)
+	commitments := []*ticketCommitment{}
+	for i := 1; i < len(ticket.TxOut); i += 2 {
+		addr, err := stake.AddrFromSStxPkScrCommitment(
+			ticket.TxOut[i].PkScript, net)
+		if err != nil {
+			return nil, err
+		}
+		commitments = append(commitments, &ticketCommitment{
+			addr:   addr,
+			amount: amounts[len(commitments)],
+		})
+	}
+	return commitments, nil
+}
+
+// fetchTicket loads the ticket purchase transaction from the node
+func fetchTicket(client coinharness.RPCClient, ticketHash *chainhash.Hash) (*wire.MsgTx, error) {
+	c, err := harnessClient(client)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := c.rawTransaction(ticketHash)
+	if err != nil {
+		return nil, err
+	}
+	if stake.DetermineTxType(tx) != stake.TxTypeSStx {
+		return nil, fmt.Errorf("transaction %v is not a ticket", ticketHash)
+	}
+	return tx, nil
+}
+
+// ticketVotingAddress returns the address the ticket's stake output pays to
+func ticketVotingAddress(ticket *wire.MsgTx, net *chaincfg.Params) (dcrutil.Address, error) {
+	out := ticket.TxOut[0]
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(out.Version,
+		out.PkScript, net)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) != 1 {
+		return nil, fmt.Errorf("unexpected ticket %v voting script",
+			ticket.TxHash())
+	}
+	return addrs[0], nil
+}
+
+// signTicketInput signs the input of tx spending the ticket's stake output
+func signTicketInput(tx *wire.MsgTx, idx int, ticket *wire.MsgTx, keys *KeyStore, net *chaincfg.Params) error {
+	addr, err := ticketVotingAddress(ticket, net)
+	if err != nil {
+		return err
+	}
+	key, err := keys.Key(addr)
+	if err != nil {
+		return err
+	}
+	sigScript, err := txscript.SignatureScript(tx, idx,
+		ticket.TxOut[0].PkScript, txscript.SigHashAll, key, true)
+	if err != nil {
+		return err
+	}
+	tx.TxIn[idx].SignatureScript = sigScript
+	return nil
+}
+
+// WinningTickets collects winning tickets reported by the node. Plug
+// its OnWinningTickets method into coinharness.NotificationHandlers
+// and register the client for winning tickets notifications.
+// WinningTickets is safe for concurrent access.
+type WinningTickets struct {
+	mtx     sync.Mutex
+	byBlock map[chainhash.Hash]*winningTicketsEntry
+}
+
+type winningTicketsEntry struct {
+	height  int64
+	tickets []*chainhash.Hash
+}
+
+// OnWinningTickets stores the winning tickets of the block
+func (w *WinningTickets) OnWinningTickets(blockHash coinharness.Hash, blockHeight int64, tickets []coinharness.Hash) {
+	entry := &winningTicketsEntry{height: blockHeight}
+	for _, t := range tickets {
+		entry.tickets = append(entry.tickets, t.(*chainhash.Hash))
+	}
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.byBlock == nil {
+		w.byBlock = make(map[chainhash.Hash]*winningTicketsEntry)
+	}
+	w.byBlock[*blockHash.(*chainhash.Hash)] = entry
+}
+
+// VoteArgs returns VoteArgs for the block, false is returned
+// when no winning tickets were reported for the block
+func (w *WinningTickets) VoteArgs(blockHash *chainhash.Hash, keys *KeyStore, net *chaincfg.Params) (*VoteArgs, bool) {
+	w.mtx.Lock()
+	entry, ok := w.byBlock[*blockHash]
+	w.mtx.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return &VoteArgs{
+		BlockHash:   blockHash,
+		BlockHeight: entry.height,
+		Tickets:     entry.tickets,
+		Keys:        keys,
+		VoteBits:    dcrutil.BlockValid,
+		Network:     net,
+	}, true
+}